@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"net/http"
+
+	"go-armory/utls"
+)
+
+// CacheInfo is a registered cache as listed by the admin handler.
+type CacheInfo struct {
+	Name  string `json:"name"`
+	Stats Stats  `json:"stats"`
+}
+
+// CacheDetail is a single cache with its keys as shown by the admin handler.
+type CacheDetail struct {
+	CacheInfo
+	Keys []string `json:"keys"`
+}
+
+// Entry is a single cached value as shown by the admin handler.
+type Entry struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// PurgeResult reports how many entries an admin purge removed.
+type PurgeResult struct {
+	Purged int `json:"purged"`
+}
+
+// AdminHandler returns a handler for inspecting and purging the caches in reg.
+// Requests for which authorize returns false are rejected with 403, a nil authorize rejects everything.
+// Mount it under a prefix with http.StripPrefix. Routes:
+//
+//	GET    /                         list caches with stats
+//	GET    /{cache}                  stats and keys of one cache
+//	GET    /{cache}/entries/{key}    a single entry
+//	DELETE /{cache}/entries/{key}    purge a single entry
+//	DELETE /{cache}?prefix=p         purge entries whose key starts with p
+//	DELETE /{cache}                  purge all entries
+func AdminHandler(reg *Registry, authorize func(*http.Request) bool) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		names := reg.Names()
+		infos := make([]CacheInfo, 0, len(names))
+		for _, name := range names {
+			if in, ok := reg.Get(name); ok {
+				infos = append(infos, CacheInfo{Name: name, Stats: in.Stats()})
+			}
+		}
+		respond(w, http.StatusOK, infos)
+	})
+
+	mux.HandleFunc("GET /{cache}", withCache(reg, func(w http.ResponseWriter, r *http.Request, in Inspector) {
+		respond(w, http.StatusOK, CacheDetail{
+			CacheInfo: CacheInfo{Name: r.PathValue("cache"), Stats: in.Stats()},
+			Keys:      in.Keys(),
+		})
+	}))
+
+	mux.HandleFunc("DELETE /{cache}", withCache(reg, func(w http.ResponseWriter, r *http.Request, in Inspector) {
+		var n int
+		if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+			n = in.PurgePrefix(prefix)
+		} else {
+			n = in.PurgeAll()
+		}
+		respond(w, http.StatusOK, PurgeResult{Purged: n})
+	}))
+
+	mux.HandleFunc("GET /{cache}/entries/{key...}", withCache(reg, func(w http.ResponseWriter, r *http.Request, in Inspector) {
+		key := r.PathValue("key")
+		value, ok := in.Lookup(key)
+		if !ok {
+			http.Error(w, "entry not found", http.StatusNotFound)
+			return
+		}
+		respond(w, http.StatusOK, Entry{Key: key, Value: value})
+	}))
+
+	mux.HandleFunc("DELETE /{cache}/entries/{key...}", withCache(reg, func(w http.ResponseWriter, r *http.Request, in Inspector) {
+		if !in.Purge(r.PathValue("key")) {
+			http.Error(w, "entry not found", http.StatusNotFound)
+			return
+		}
+		respond(w, http.StatusOK, PurgeResult{Purged: 1})
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// withCache resolves the {cache} path value and responds 404 when it isn't registered.
+func withCache(reg *Registry, h func(http.ResponseWriter, *http.Request, Inspector)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		in, ok := reg.Get(r.PathValue("cache"))
+		if !ok {
+			http.Error(w, "cache not found", http.StatusNotFound)
+			return
+		}
+		h(w, r, in)
+	}
+}
+
+// respond writes payload as JSON, falling back to a 500 when it can't be encoded (eg. a cached func or chan).
+func respond(w http.ResponseWriter, code int, payload any) {
+	if err := utls.RespondWithJSON(w, code, payload); err != nil {
+		http.Error(w, "failed to encode response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
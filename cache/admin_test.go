@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newAdminFixture() (*Cache[string, int], http.Handler) {
+	users := New[string, int]()
+	users.Set("user:1", 1)
+	users.Set("user:2", 2)
+	users.Set("team:1", 3)
+	users.Get("user:1")
+	users.Get("missing")
+
+	ids := New[int, string]()
+	ids.Set(42, "answer")
+
+	reg := NewRegistry()
+	Register(reg, "users", users)
+	Register(reg, "ids", ids)
+
+	allow := func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" }
+	return users, AdminHandler(reg, allow)
+}
+
+func serveAdmin(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("X-Admin", "yes")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminHandlerList(t *testing.T) {
+	_, h := newAdminFixture()
+
+	rec := serveAdmin(h, http.MethodGet, "/")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	var infos []CacheInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := []CacheInfo{
+		{Name: "ids", Stats: Stats{Len: 1}},
+		{Name: "users", Stats: Stats{Hits: 1, Misses: 1, Len: 3}},
+	}
+	if len(infos) != len(want) {
+		t.Fatalf("got %d caches, want %d", len(infos), len(want))
+	}
+	for i := range want {
+		if infos[i] != want[i] {
+			t.Errorf("infos[%d] = %+v, want %+v", i, infos[i], want[i])
+		}
+	}
+}
+
+func TestAdminHandlerEntry(t *testing.T) {
+	users, h := newAdminFixture()
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		value  any
+	}{
+		{"string key", "/users/entries/user:2", http.StatusOK, float64(2)},
+		{"int key", "/ids/entries/42", http.StatusOK, "answer"},
+		{"missing key", "/users/entries/nope", http.StatusNotFound, nil},
+		{"missing cache", "/nope/entries/1", http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveAdmin(h, http.MethodGet, tt.target)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var e Entry
+			if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if e.Value != tt.value {
+				t.Errorf("value = %v, want %v", e.Value, tt.value)
+			}
+		})
+	}
+
+	if s := users.Stats(); s.Hits != 1 || s.Misses != 1 {
+		t.Errorf("inspecting entries changed stats: %+v", s)
+	}
+}
+
+func TestAdminHandlerPurge(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		purged  int
+		wantLen int
+	}{
+		{"by key", "/users/entries/user:1", 1, 2},
+		{"by prefix", "/users?prefix=user:", 2, 1},
+		{"all", "/users", 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, h := newAdminFixture()
+
+			rec := serveAdmin(h, http.MethodDelete, tt.target)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			var res PurgeResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if res.Purged != tt.purged {
+				t.Errorf("purged = %d, want %d", res.Purged, tt.purged)
+			}
+			if n := users.Len(); n != tt.wantLen {
+				t.Errorf("Len() = %d, want %d", n, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerAuthorize(t *testing.T) {
+	users, h := newAdminFixture()
+
+	req := httptest.NewRequest(http.MethodDelete, "/users", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+	if users.Len() != 3 {
+		t.Error("unauthorized request purged the cache")
+	}
+}
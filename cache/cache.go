@@ -1,28 +1,154 @@
 package cache
 
 import (
+	"container/list"
+	"slices"
 	"sync"
 )
 
+// Stats is a point-in-time snapshot of a cache's counters.
+type Stats struct {
+	Hits      uint64 `json:"hits"`      // Number of Get calls that found the key.
+	Misses    uint64 `json:"misses"`    // Number of Get calls that did not find the key.
+	Evictions uint64 `json:"evictions"` // Number of entries dropped to stay within capacity.
+	Len       int    `json:"len"`       // Number of entries currently stored.
+}
+
+// Option configures a Cache created with New.
+type Option func(*options)
+
+type options struct {
+	capacity int
+}
+
+// WithCapacity bounds the number of entries. Once full, the least recently used entry is evicted.
+// The capacity is shared by the cache and all of its namespaces. Zero or negative means unbounded.
+func WithCapacity(n int) Option {
+	return func(o *options) {
+		o.capacity = n
+	}
+}
+
+// pool is the state shared by a root cache and its namespaces: one lock, one capacity and one LRU order.
+type pool[K comparable, V any] struct {
+	mu         sync.Mutex
+	lru        *list.List // Elements are *entry[K, V], front is most recently used.
+	capacity   int
+	namespaces map[string]*Cache[K, V]
+}
+
+// entry is a single cached value, owner is the (namespaced) cache whose key space it lives in.
+type entry[K comparable, V any] struct {
+	owner *Cache[K, V]
+	key   K
+	value V
+}
+
 // Cache is a basic in-memory key-value cache implementation.
 type Cache[K comparable, V any] struct {
-	items map[K]V    // The map storing key-value pairs.
-	mu    sync.Mutex // Mutex for controlling concurrent access to the cache.
+	items map[K]*list.Element       // The map storing key -> LRU element holding the entry.
+	tags  map[string]map[K]struct{} // Tag index, tag -> keys carrying that tag.
+	keyTg map[K][]string            // Reverse tag index, key -> tags, used to untag on removal.
+	mu    *sync.Mutex               // Mutex for controlling concurrent access, shared with namespaces.
+	pool  *pool[K, V]
+	name  string // Namespace name, empty for the root cache.
+
+	hits, misses, evictions uint64 // Counters, guarded by mu.
 }
 
 // New creates a new Cache instance.
-func New[K comparable, V any]() *Cache[K, V] {
+func New[K comparable, V any](opts ...Option) *Cache[K, V] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p := &pool[K, V]{
+		lru:        list.New(),
+		capacity:   o.capacity,
+		namespaces: make(map[string]*Cache[K, V]),
+	}
+	return newCache(p, "")
+}
+
+func newCache[K comparable, V any](p *pool[K, V], name string) *Cache[K, V] {
 	return &Cache[K, V]{
-		items: make(map[K]V),
+		items: make(map[K]*list.Element),
+		tags:  make(map[string]map[K]struct{}),
+		keyTg: make(map[K][]string),
+		mu:    &p.mu,
+		pool:  p,
+		name:  name,
 	}
 }
 
+// Namespace returns a view with its own key space, tags and stats that shares this cache's
+// capacity and eviction order, so one busy namespace can evict entries of another.
+// Calling it again with the same name returns the same view. Namespaces are flat, calling
+// Namespace on a namespace is the same as calling it on the root cache.
+func (c *Cache[K, V]) Namespace(name string) *Cache[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ns, ok := c.pool.namespaces[name]
+	if !ok {
+		ns = newCache(c.pool, name)
+		c.pool.namespaces[name] = ns
+	}
+	return ns
+}
+
+// Namespaces returns the names of the namespaces created so far, in sorted order.
+func (c *Cache[K, V]) Namespaces() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.pool.namespaces))
+	for name := range c.pool.namespaces {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Name returns the namespace name, empty for the root cache.
+func (c *Cache[K, V]) Name() string {
+	return c.name
+}
+
 // Set adds or updates a key-value pair in the cache.
+// Any tags previously attached to key are dropped.
 func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTags(key, value)
+}
+
+// SetWithTags adds or updates a key-value pair and attaches tags to it, so that
+// the entry can later be dropped as part of a group with RemoveTag.
+func (c *Cache[K, V]) SetWithTags(key K, value V, tags ...string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.items[key] = value
+	c.untag(key)
+	if el, ok := c.items[key]; ok {
+		el.Value.(*entry[K, V]).value = value
+		c.pool.lru.MoveToFront(el)
+	} else {
+		c.items[key] = c.pool.lru.PushFront(&entry[K, V]{owner: c, key: key, value: value})
+		c.pool.evict()
+	}
+
+	if len(tags) == 0 {
+		return
+	}
+	c.keyTg[key] = slices.Clone(tags) // the caller may reuse its slice.
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[K]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
 }
 
 // Get retrieves the value associated with the given key from the cache. The bool
@@ -31,8 +157,15 @@ func (c *Cache[K, V]) Get(key K) (V, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	value, found := c.items[key]
-	return value, found
+	el, found := c.items[key]
+	if !found {
+		c.misses++
+		var zero V
+		return zero, false
+	}
+	c.hits++
+	c.pool.lru.MoveToFront(el)
+	return el.Value.(*entry[K, V]).value, true
 }
 
 // Remove deletes the key-value pair with the specified key from the cache.
@@ -40,7 +173,21 @@ func (c *Cache[K, V]) Remove(key K) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	delete(c.items, key)
+	c.delete(key)
+}
+
+// RemoveTag deletes every entry carrying tag and returns how many were removed.
+func (c *Cache[K, V]) RemoveTag(tag string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := c.tags[tag]
+	n := 0
+	for key := range keys {
+		c.delete(key)
+		n++
+	}
+	return n
 }
 
 // Pop removes and returns the value associated with the specified key from the cache.
@@ -48,12 +195,110 @@ func (c *Cache[K, V]) Pop(key K) (V, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	value, found := c.items[key]
+	el, found := c.items[key]
+	if !found {
+		var zero V
+		return zero, false
+	}
 
 	// If the key is found, delete the key-value pair from the cache.
-	if found {
-		delete(c.items, key)
+	value := el.Value.(*entry[K, V]).value
+	c.delete(key)
+
+	return value, true
+}
+
+// Len returns the number of entries in the cache.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// Keys returns a snapshot of the keys currently in the cache, in no particular order.
+func (c *Cache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]K, 0, len(c.items))
+	for key := range c.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Stats returns the counters and current size of the cache.
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Hits: c.hits, Misses: c.misses, Evictions: c.evictions, Len: len(c.items)}
+}
+
+// RemoveFunc deletes every entry whose key satisfies pred and returns how many were removed.
+func (c *Cache[K, V]) RemoveFunc(pred func(K) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for key := range c.items {
+		if pred(key) {
+			c.delete(key)
+			n++
+		}
 	}
+	return n
+}
 
-	return value, found
+// Clear deletes every entry and returns how many were removed. Stats counters are kept.
+// Only this cache's key space is cleared, namespaces are left alone.
+func (c *Cache[K, V]) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.items)
+	for _, el := range c.items {
+		c.pool.lru.Remove(el)
+	}
+	clear(c.items)
+	clear(c.tags)
+	clear(c.keyTg)
+	return n
+}
+
+// delete removes key from the cache, its tags and the LRU order. Caller must hold c.mu.
+func (c *Cache[K, V]) delete(key K) {
+	el, ok := c.items[key]
+	if !ok {
+		return
+	}
+	c.untag(key)
+	c.pool.lru.Remove(el)
+	delete(c.items, key)
+}
+
+// untag removes key from the tag indexes. Caller must hold c.mu.
+func (c *Cache[K, V]) untag(key K) {
+	for _, tag := range c.keyTg[key] {
+		keys := c.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	delete(c.keyTg, key)
+}
+
+// evict drops least recently used entries, from whichever namespace owns them, until the pool
+// is within capacity. Caller must hold p.mu.
+func (p *pool[K, V]) evict() {
+	if p.capacity <= 0 {
+		return
+	}
+	for p.lru.Len() > p.capacity {
+		e := p.lru.Back().Value.(*entry[K, V])
+		e.owner.delete(e.key)
+		e.owner.evictions++
+	}
 }
@@ -0,0 +1,129 @@
+package cache
+
+import "testing"
+
+func TestRemoveTag(t *testing.T) {
+	c := New[string, int]()
+	c.SetWithTags("u1", 1, "users", "eu")
+	c.SetWithTags("u2", 2, "users")
+	c.SetWithTags("o1", 3, "orders", "eu")
+	c.Set("plain", 4)
+
+	if n := c.RemoveTag("eu"); n != 2 {
+		t.Errorf("RemoveTag(eu) = %d, want 2", n)
+	}
+	if _, ok := c.Get("u2"); !ok {
+		t.Error("u2 should survive removing tag eu")
+	}
+	if n := c.RemoveTag("users"); n != 1 {
+		t.Errorf("RemoveTag(users) = %d, want 1", n)
+	}
+	if n := c.RemoveTag("orders"); n != 0 {
+		t.Errorf("RemoveTag(orders) = %d, want 0 after o1 was removed", n)
+	}
+	if _, ok := c.Get("plain"); !ok {
+		t.Error("untagged key should not be removed")
+	}
+}
+
+func TestSetDropsTags(t *testing.T) {
+	c := New[string, int]()
+	c.SetWithTags("a", 1, "t")
+	c.Set("a", 2)
+
+	if n := c.RemoveTag("t"); n != 0 {
+		t.Errorf("RemoveTag(t) = %d, want 0 after Set replaced the entry", n)
+	}
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Errorf("Get(a) = %d, %v; want 2, true", v, ok)
+	}
+}
+
+func TestSetWithTagsCopiesTags(t *testing.T) {
+	c := New[string, int]()
+	tags := []string{"x"}
+	c.SetWithTags("a", 1, tags...)
+	tags[0] = "y" // reused by the caller.
+	c.Set("a", 2)
+
+	if n := c.RemoveTag("x"); n != 0 {
+		t.Errorf("RemoveTag(x) = %d, want 0 after Set replaced the entry", n)
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a was removed through a stale tag")
+	}
+}
+
+func TestCapacityEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](WithCapacity(2))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a") // b is now least recently used.
+	c.SetWithTags("c", 3, "t")
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+	if s := c.Stats(); s.Evictions != 1 || s.Len != 2 {
+		t.Errorf("Stats() = %+v, want 1 eviction and len 2", s)
+	}
+
+	c.Set("a", 10) // updating an existing key must not evict.
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	root := New[string, int](WithCapacity(3))
+	users := root.Namespace("users")
+	orders := root.Namespace("orders")
+
+	if root.Namespace("users") != users {
+		t.Error("Namespace should return the same view for the same name")
+	}
+
+	users.Set("1", 100)
+	orders.Set("1", 200)
+	if v, _ := users.Get("1"); v != 100 {
+		t.Errorf("users[1] = %d, want 100", v)
+	}
+	if v, _ := orders.Get("1"); v != 200 {
+		t.Errorf("orders[1] = %d, want 200", v)
+	}
+	if _, ok := root.Get("1"); ok {
+		t.Error("root should not see namespaced keys")
+	}
+
+	// users:1 is now least recently used across the shared budget.
+	orders.Set("2", 201)
+	orders.Set("3", 202)
+	if _, ok := users.Get("1"); ok {
+		t.Error("users:1 should have been evicted by orders filling the shared capacity")
+	}
+	if s := users.Stats(); s.Evictions != 1 || s.Len != 0 {
+		t.Errorf("users.Stats() = %+v, want 1 eviction and len 0", s)
+	}
+	if s := orders.Stats(); s.Evictions != 0 || s.Len != 3 {
+		t.Errorf("orders.Stats() = %+v, want 0 evictions and len 3", s)
+	}
+
+	if n := orders.Clear(); n != 3 {
+		t.Errorf("orders.Clear() = %d, want 3", n)
+	}
+	users.Set("a", 1)
+	users.Set("b", 2)
+	users.Set("c", 3)
+	if s := users.Stats(); s.Evictions != 1 {
+		t.Errorf("Clear should free shared capacity, users.Stats() = %+v", s)
+	}
+
+	if got := root.Namespaces(); len(got) != 2 || got[0] != "orders" || got[1] != "users" {
+		t.Errorf("Namespaces() = %v", got)
+	}
+}
@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+	SignatureHeader = "X-Armory-Signature"
+	// TimestampHeader carries the unix time the batch was signed at.
+	TimestampHeader = "X-Armory-Timestamp"
+	// DefaultMaxSkew is the replay window InvalidationHandler uses when given none.
+	DefaultMaxSkew = 5 * time.Minute
+
+	maxInvalidationBody = 1 << 20 // 1MB, a batch of keys should never get near this.
+)
+
+// Invalidation is a batch of keys and tags to drop, as sent between peers.
+type Invalidation struct {
+	Keys []string `json:"keys,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func (inv Invalidation) empty() bool {
+	return len(inv.Keys) == 0 && len(inv.Tags) == 0
+}
+
+// BroadcasterConfig configures a Broadcaster.
+type BroadcasterConfig struct {
+	Peers  []string // Full URLs of the peers InvalidationHandler, eg. http://10.0.0.2:8080/_cache/invalidate
+	Secret []byte   // Shared HMAC secret, must match the one given to InvalidationHandler. Required.
+
+	Client        *http.Client  // Defaults to a client with a 5s timeout.
+	BatchSize     int           // Flush once this many keys+tags are queued. Defaults to 100.
+	FlushInterval time.Duration // Flush queued invalidations at least this often. Defaults to 100ms.
+	MaxRetries    int           // Retries per peer on network errors and 5xx. Defaults to 3, negative disables retries.
+	RetryBackoff  time.Duration // Initial backoff, doubled after each retry. Defaults to 50ms.
+
+	// OnError is called with the failed peer and error after retries are exhausted.
+	OnError func(peer string, err error)
+}
+
+// Broadcaster queues key/tag invalidations and POSTs them in batches to every configured peer.
+// It only notifies peers, the caller is expected to drop the entries from its own cache.
+type Broadcaster struct {
+	cfg BroadcasterConfig
+
+	mu      sync.Mutex
+	pending Invalidation
+
+	kick chan struct{} // signals the loop that BatchSize was reached.
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewBroadcaster creates a Broadcaster and starts its background flush loop.
+// Call Close to flush what is left and stop the loop. It panics when cfg.Secret is empty.
+func NewBroadcaster(cfg BroadcasterConfig) *Broadcaster {
+	if len(cfg.Secret) == 0 {
+		panic("cache: Broadcaster needs a secret")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 100 * time.Millisecond
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 50 * time.Millisecond
+	}
+
+	b := &Broadcaster{
+		cfg:  cfg,
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// Invalidate queues keys to be dropped on every peer.
+func (b *Broadcaster) Invalidate(keys ...string) {
+	b.enqueue(Invalidation{Keys: keys})
+}
+
+// InvalidateTags queues tags to be dropped on every peer.
+func (b *Broadcaster) InvalidateTags(tags ...string) {
+	b.enqueue(Invalidation{Tags: tags})
+}
+
+func (b *Broadcaster) enqueue(inv Invalidation) {
+	b.mu.Lock()
+	b.pending.Keys = append(b.pending.Keys, inv.Keys...)
+	b.pending.Tags = append(b.pending.Tags, inv.Tags...)
+	full := len(b.pending.Keys)+len(b.pending.Tags) >= b.cfg.BatchSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush sends everything queued so far to all peers and waits for the result.
+// The returned error joins the errors of every peer that could not be reached.
+func (b *Broadcaster) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = Invalidation{}
+	b.mu.Unlock()
+
+	if batch.empty() {
+		return nil
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode invalidation: %w", err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, peer := range b.cfg.Peers {
+		wg.Go(func() {
+			if err := b.send(ctx, peer, body); err != nil {
+				if b.cfg.OnError != nil {
+					b.cfg.OnError(peer, err)
+				}
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("peer %s: %w", peer, err))
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Close flushes pending invalidations and stops the background loop.
+func (b *Broadcaster) Close() error {
+	b.once.Do(func() { close(b.stop) })
+	<-b.done
+	return b.Flush(context.Background())
+}
+
+func (b *Broadcaster) loop() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.kick:
+		}
+		b.Flush(context.Background()) // errors are reported through OnError.
+	}
+}
+
+// send POSTs a signed batch to a single peer, retrying on network errors and 5xx responses.
+func (b *Broadcaster) send(ctx context.Context, peer string, body []byte) error {
+	backoff := b.cfg.RetryBackoff
+
+	var err error
+	for attempt := 0; attempt <= b.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		var retry bool
+		retry, err = b.post(ctx, peer, body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (b *Broadcaster) post(ctx context.Context, peer string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, ts)
+	req.Header.Set(SignatureHeader, sign(b.cfg.Secret, ts, body))
+
+	resp, err := b.cfg.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return false, nil
+}
+
+// InvalidationHandler returns a handler that verifies signed batches sent by a Broadcaster
+// and drops the listed keys and tags from c.
+// Requests older than maxSkew (or from further in the future) are rejected to limit replays,
+// maxSkew defaults to DefaultMaxSkew when zero or negative.
+// It panics when secret is empty, anyone can sign with an empty key.
+func InvalidationHandler[V any](c *Cache[string, V], secret []byte, maxSkew time.Duration) http.Handler {
+	if len(secret) == 0 {
+		panic("cache: InvalidationHandler needs a secret")
+	}
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxInvalidationBody))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		ts := r.Header.Get(TimestampHeader)
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid timestamp", http.StatusUnauthorized)
+			return
+		}
+		if skew := time.Since(time.Unix(unix, 0)).Abs(); skew > maxSkew {
+			http.Error(w, "stale timestamp", http.StatusUnauthorized)
+			return
+		}
+
+		got, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+		if err != nil {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		want, _ := hex.DecodeString(sign(secret, ts, body))
+		if !hmac.Equal(got, want) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var inv Invalidation
+		if err := json.Unmarshal(body, &inv); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+
+		for _, key := range inv.Keys {
+			c.Remove(key)
+		}
+		for _, tag := range inv.Tags {
+			c.RemoveTag(tag)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func sign(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("s3cret")
+
+func TestBroadcasterInvalidatesPeers(t *testing.T) {
+	peers := make([]*Cache[string, int], 3)
+	urls := make([]string, len(peers))
+	for i := range peers {
+		c := New[string, int]()
+		c.Set("a", 1)
+		c.Set("b", 2)
+		c.SetWithTags("u1", 3, "users")
+		c.SetWithTags("u2", 4, "users")
+		peers[i] = c
+
+		srv := httptest.NewServer(InvalidationHandler(c, testSecret, time.Minute))
+		t.Cleanup(srv.Close)
+		urls[i] = srv.URL
+	}
+
+	b := NewBroadcaster(BroadcasterConfig{Peers: urls, Secret: testSecret, FlushInterval: time.Hour})
+	defer b.Close()
+
+	b.Invalidate("a")
+	b.InvalidateTags("users")
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	for i, c := range peers {
+		for _, key := range []string{"a", "u1", "u2"} {
+			if _, ok := c.Get(key); ok {
+				t.Errorf("peer %d: key %q still cached", i, key)
+			}
+		}
+		if _, ok := c.Get("b"); !ok {
+			t.Errorf("peer %d: key %q should not be invalidated", i, "b")
+		}
+	}
+}
+
+func TestBroadcasterFlushesOnBatchSize(t *testing.T) {
+	c := New[string, int]()
+	c.Set("a", 1)
+	c.Set("b", 2)
+	srv := httptest.NewServer(InvalidationHandler(c, testSecret, time.Minute))
+	defer srv.Close()
+
+	b := NewBroadcaster(BroadcasterConfig{Peers: []string{srv.URL}, Secret: testSecret, BatchSize: 2, FlushInterval: time.Hour})
+	defer b.Close()
+
+	b.Invalidate("a", "b")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		_, okA := c.Get("a")
+		_, okB := c.Get("b")
+		if !okA && !okB {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("batch was not flushed after reaching BatchSize")
+}
+
+func TestBroadcasterRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"server error is retried", http.StatusServiceUnavailable, 3, true},
+		{"client error is not retried", http.StatusUnauthorized, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			b := NewBroadcaster(BroadcasterConfig{
+				Peers:         []string{srv.URL},
+				Secret:        testSecret,
+				FlushInterval: time.Hour,
+				MaxRetries:    2,
+				RetryBackoff:  time.Millisecond,
+			})
+			defer b.Close()
+
+			b.Invalidate("a")
+			err := b.Flush(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Flush() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestBroadcasterRecoversAfterRetry(t *testing.T) {
+	c := New[string, int]()
+	c.Set("a", 1)
+	h := InvalidationHandler(c, testSecret, time.Minute)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	b := NewBroadcaster(BroadcasterConfig{Peers: []string{srv.URL}, Secret: testSecret, FlushInterval: time.Hour, RetryBackoff: time.Millisecond})
+	defer b.Close()
+
+	b.Invalidate("a")
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("key still cached after retried delivery")
+	}
+}
+
+func TestInvalidationHandlerRejects(t *testing.T) {
+	body := `{"keys":["a"]}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		method string
+		ts     string
+		sig    string
+		want   int
+		skew   time.Duration
+	}{
+		{"valid", http.MethodPost, now, sign(testSecret, now, []byte(body)), http.StatusNoContent, time.Minute},
+		{"wrong method", http.MethodGet, now, sign(testSecret, now, []byte(body)), http.StatusMethodNotAllowed, time.Minute},
+		{"wrong secret", http.MethodPost, now, sign([]byte("other"), now, []byte(body)), http.StatusUnauthorized, time.Minute},
+		{"missing signature", http.MethodPost, now, "", http.StatusUnauthorized, time.Minute},
+		{"stale timestamp", http.MethodPost, old, sign(testSecret, old, []byte(body)), http.StatusUnauthorized, time.Minute},
+		{"stale timestamp, default skew", http.MethodPost, old, sign(testSecret, old, []byte(body)), http.StatusUnauthorized, 0},
+		{"missing timestamp", http.MethodPost, "", sign(testSecret, "", []byte(body)), http.StatusUnauthorized, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int]()
+			c.Set("a", 1)
+
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(body))
+			req.Header.Set(TimestampHeader, tt.ts)
+			req.Header.Set(SignatureHeader, tt.sig)
+			rec := httptest.NewRecorder()
+
+			InvalidationHandler(c, testSecret, tt.skew).ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			_, cached := c.Get("a")
+			if cached == (tt.want == http.StatusNoContent) {
+				t.Errorf("cached = %v after status %d", cached, rec.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidationRequiresSecret(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"broadcaster nil", func() { NewBroadcaster(BroadcasterConfig{}) }},
+		{"broadcaster empty", func() { NewBroadcaster(BroadcasterConfig{Secret: []byte{}}) }},
+		{"handler nil", func() { InvalidationHandler(New[string, int](), nil, time.Minute) }},
+		{"handler empty", func() { InvalidationHandler(New[string, int](), []byte{}, time.Minute) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Inspector is the type-erased view of a cache used by the admin handler.
+// Keys are addressed by their fmt.Sprint form so caches of any key type can be inspected.
+type Inspector interface {
+	Stats() Stats
+	Keys() []string
+	Lookup(key string) (any, bool)
+	Purge(key string) bool
+	PurgePrefix(prefix string) int
+	PurgeAll() int
+}
+
+// Registry holds named caches so they can be inspected and purged at runtime.
+type Registry struct {
+	mu     sync.RWMutex
+	caches map[string]Inspector
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{caches: make(map[string]Inspector)}
+}
+
+// Register adds c to r under name, replacing any cache previously registered with that name.
+func Register[K comparable, V any](r *Registry, name string, c *Cache[K, V]) {
+	r.Add(name, inspector[K, V]{c})
+}
+
+// Add registers a custom Inspector under name.
+func (r *Registry) Add(name string, in Inspector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.caches[name] = in
+}
+
+// Unregister removes the cache registered under name.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.caches, name)
+}
+
+// Get returns the cache registered under name.
+func (r *Registry) Get(name string) (Inspector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	in, ok := r.caches[name]
+	return in, ok
+}
+
+// Names returns the registered names in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.caches))
+	for name := range r.caches {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// inspector adapts a *Cache to the Inspector interface.
+type inspector[K comparable, V any] struct {
+	c *Cache[K, V]
+}
+
+func (in inspector[K, V]) Stats() Stats {
+	return in.c.Stats()
+}
+
+func (in inspector[K, V]) Keys() []string {
+	keys := make([]string, 0, in.c.Len())
+	for _, key := range in.c.Keys() {
+		keys = append(keys, fmt.Sprint(key))
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Lookup does not go through Get so that inspecting a cache doesn't skew its hit/miss stats.
+func (in inspector[K, V]) Lookup(key string) (any, bool) {
+	in.c.mu.Lock()
+	defer in.c.mu.Unlock()
+
+	for k, el := range in.c.items {
+		if fmt.Sprint(k) == key {
+			return el.Value.(*entry[K, V]).value, true
+		}
+	}
+	return nil, false
+}
+
+func (in inspector[K, V]) Purge(key string) bool {
+	return in.c.RemoveFunc(func(k K) bool { return fmt.Sprint(k) == key }) > 0
+}
+
+func (in inspector[K, V]) PurgePrefix(prefix string) int {
+	return in.c.RemoveFunc(func(k K) bool { return strings.HasPrefix(fmt.Sprint(k), prefix) })
+}
+
+func (in inspector[K, V]) PurgeAll() int {
+	return in.c.Clear()
+}
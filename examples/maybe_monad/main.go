@@ -28,7 +28,8 @@ func example2_Configuration() {
 
 func main() {
 	fmt.Println("Maybe Monad Practical Examples")
-	fmt.Println("================================\n")
+	fmt.Println("================================")
+	fmt.Println()
 
 	example2_Configuration()
 	//	example4_QueryParameters()
@@ -0,0 +1,45 @@
+package metrics
+
+import "go-armory/cache"
+
+// Caches exposes hit, miss and size metrics for every cache in caches, labelled by the registered name.
+// The cache registry is read on each scrape, so caches registered later are picked up automatically.
+func (r *Registry) Caches(caches *cache.Registry) {
+	r.addCollector(cacheCollector{caches},
+		"armory_cache_hits_total",
+		"armory_cache_misses_total",
+		"armory_cache_entries",
+	)
+}
+
+type cacheCollector struct {
+	caches *cache.Registry
+}
+
+func (c cacheCollector) collect(w *writer) {
+	names := c.caches.Names()
+	stats := make([]cache.Stats, 0, len(names))
+	for _, name := range names {
+		var s cache.Stats
+		if in, ok := c.caches.Get(name); ok {
+			s = in.Stats()
+		}
+		stats = append(stats, s)
+	}
+
+	labels := []string{"cache"}
+	families := []struct {
+		name, help, typ string
+		value           func(cache.Stats) float64
+	}{
+		{"armory_cache_hits_total", "Cache lookups that found the key.", "counter", func(s cache.Stats) float64 { return float64(s.Hits) }},
+		{"armory_cache_misses_total", "Cache lookups that did not find the key.", "counter", func(s cache.Stats) float64 { return float64(s.Misses) }},
+		{"armory_cache_entries", "Entries currently stored in the cache.", "gauge", func(s cache.Stats) float64 { return float64(s.Len) }},
+	}
+	for _, f := range families {
+		w.header(f.name, f.help, f.typ)
+		for i, name := range names {
+			w.sample(f.name, labels, []string{name}, "", "", f.value(stats[i]))
+		}
+	}
+}
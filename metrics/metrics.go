@@ -0,0 +1,424 @@
+// Package metrics is a small dependency-free metrics registry that exposes
+// counters, gauges and histograms in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, tailored to HTTP latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector writes one or more complete metric families.
+type collector interface {
+	collect(w *writer)
+}
+
+// Registry holds metrics and renders them on scrape.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]collector // registered metric families by name.
+	collectors []collector          // in registration order, so output is stable.
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]collector)}
+}
+
+// Counter registers a monotonically increasing counter. Registering the same name twice returns
+// the existing counter, registering it with a different type or labels panics.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return register(r, name, &Counter{vec: newVec(name, help, "counter", labels)})
+}
+
+// Gauge registers a value that can go up and down. See Counter for re-registration rules.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return register(r, name, &Gauge{vec: newVec(name, help, "gauge", labels)})
+}
+
+// Histogram registers a histogram with the given upper bounds, DefBuckets if buckets is nil.
+// See Counter for re-registration rules, the buckets must match too.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return register(r, name, &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histSeries),
+	})
+}
+
+// GaugeFunc registers a gauge whose value is read from fn on every scrape.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	register(r, name, &funcMetric{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+// CounterFunc registers a counter whose value is read from fn on every scrape.
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	register(r, name, &funcMetric{name: name, help: help, typ: "counter", fn: fn})
+}
+
+func register[C collector](r *Registry, name string, c C) C {
+	if !validName(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.names[name]; ok {
+		same, ok := existing.(C)
+		if !ok || !sameShape(existing, c) {
+			panic(fmt.Sprintf("metrics: %q already registered with a different type, labels or buckets", name))
+		}
+		return same
+	}
+	r.names[name] = c
+	r.collectors = append(r.collectors, c)
+	return c
+}
+
+// addCollector registers a collector that writes several families, claiming each of their names.
+func (r *Registry) addCollector(c collector, names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range names {
+		if _, ok := r.names[name]; ok {
+			panic(fmt.Sprintf("metrics: %q already registered", name))
+		}
+	}
+	for _, name := range names {
+		r.names[name] = c
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+func sameShape(a, b collector) bool {
+	labelsOf := func(c collector) []string {
+		switch m := c.(type) {
+		case *Counter:
+			return m.labels
+		case *Gauge:
+			return m.labels
+		case *Histogram:
+			return m.labels
+		case *funcMetric:
+			return []string{m.typ}
+		}
+		return nil
+	}
+	if ha, ok := a.(*Histogram); ok {
+		if hb, ok := b.(*Histogram); !ok || !slices.Equal(ha.buckets, hb.buckets) {
+			return false
+		}
+	}
+	return slices.Equal(labelsOf(a), labelsOf(b))
+}
+
+// WriteTo writes every registered metric in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	bw := &writer{w: bufio.NewWriter(w)}
+	for _, c := range collectors {
+		c.collect(bw)
+	}
+	if err := bw.w.Flush(); err != nil {
+		return bw.n, err
+	}
+	return bw.n, bw.err
+}
+
+// Handler returns an http.Handler serving the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// vec holds label-partitioned float values, shared by Counter and Gauge.
+type vec struct {
+	name, help, typ string
+	labels          []string
+
+	mu     sync.Mutex
+	keys   []string // series keys in creation order.
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+}
+
+// get returns the series for labelValues. Caller must hold v.mu.
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: slices.Clone(labelValues)}
+		v.series[key] = s
+		v.keys = append(v.keys, key)
+	}
+	return s
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.get(labelValues).value += delta
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.get(labelValues).value = value
+}
+
+func (v *vec) value(labelValues []string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.get(labelValues).value
+}
+
+func (v *vec) collect(w *writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	w.header(v.name, v.help, v.typ)
+	for _, key := range v.keys {
+		s := v.series[key]
+		w.sample(v.name, v.labels, s.labelValues, "", "", s.value)
+	}
+}
+
+// Counter is a monotonically increasing value, optionally partitioned by labels.
+type Counter struct {
+	*vec
+}
+
+// Inc adds one to the series identified by labelValues.
+func (c *Counter) Inc(labelValues ...string) {
+	c.vec.add(1, labelValues)
+}
+
+// Add adds delta, which must not be negative, to the series identified by labelValues.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.vec.add(delta, labelValues)
+}
+
+// Value returns the current value of the series identified by labelValues.
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.vec.value(labelValues)
+}
+
+// Gauge is a value that can go up and down, optionally partitioned by labels.
+type Gauge struct {
+	*vec
+}
+
+// Set sets the series identified by labelValues to value.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.vec.set(value, labelValues)
+}
+
+// Add adds delta to the series identified by labelValues.
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.vec.add(delta, labelValues)
+}
+
+// Inc adds one to the series identified by labelValues.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.vec.add(1, labelValues)
+}
+
+// Dec subtracts one from the series identified by labelValues.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.vec.add(-1, labelValues)
+}
+
+// Value returns the current value of the series identified by labelValues.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.vec.value(labelValues)
+}
+
+// Histogram counts observations into cumulative buckets, optionally partitioned by labels.
+type Histogram struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	keys   []string
+	series map[string]*histSeries
+}
+
+type histSeries struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative.
+	count       uint64
+	sum         float64
+}
+
+// Observe records value in the series identified by labelValues.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.name, len(h.labels), len(labelValues)))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histSeries{labelValues: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+		h.keys = append(h.keys, key)
+	}
+
+	if i, _ := slices.BinarySearch(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) collect(w *writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w.header(h.name, h.help, "histogram")
+	for _, key := range h.keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			w.sample(h.name+"_bucket", h.labels, s.labelValues, "le", formatFloat(upper), float64(cumulative))
+		}
+		w.sample(h.name+"_bucket", h.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		w.sample(h.name+"_sum", h.labels, s.labelValues, "", "", s.sum)
+		w.sample(h.name+"_count", h.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+// funcMetric is an unlabelled gauge or counter read on scrape.
+type funcMetric struct {
+	name, help, typ string
+	fn              func() float64
+}
+
+func (f *funcMetric) collect(w *writer) {
+	w.header(f.name, f.help, f.typ)
+	w.sample(f.name, nil, nil, "", "", f.fn())
+}
+
+// writer renders the text exposition format, remembering the first error.
+type writer struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *writer) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *writer) header(name, help, typ string) {
+	if help != "" {
+		w.printf("# HELP %s %s\n", name, helpEscaper.Replace(help))
+	}
+	w.printf("# TYPE %s %s\n", name, typ)
+}
+
+// sample writes a single line, extraName/extraValue add a trailing label such as le.
+func (w *writer) sample(name string, labels, values []string, extraName, extraValue string, v float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=\"%s\"", l, labelEscaper.Replace(values[i]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=\"%s\"", extraName, extraValue)
+		}
+		b.WriteByte('}')
+	}
+	w.printf("%s %s\n", b.String(), formatFloat(v))
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// validName reports whether name matches [a-zA-Z_:][a-zA-Z0-9_:]*.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_' || c == ':', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
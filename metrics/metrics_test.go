@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-armory/cache"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.Counter("jobs_total", "Jobs processed.", "queue")
+	c.Inc("default")
+	c.Add(2, "default")
+	c.Inc(`we"ird`)
+
+	g := r.Gauge("workers", "Busy workers.\nSecond line.")
+	g.Set(5)
+	g.Dec()
+
+	h := r.Histogram("latency_seconds", "", []float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(3)
+
+	r.GaugeFunc("answer", "Always 42.", func() float64 { return 42 })
+
+	want := `# HELP jobs_total Jobs processed.
+# TYPE jobs_total counter
+jobs_total{queue="default"} 3
+jobs_total{queue="we\"ird"} 1
+# HELP workers Busy workers.\nSecond line.
+# TYPE workers gauge
+workers 4
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.15
+latency_seconds_count 3
+# HELP answer Always 42.
+# TYPE answer gauge
+answer 42
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("exposition mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	a := r.Counter("hits_total", "", "code")
+	b := r.Counter("hits_total", "", "code")
+	if a != b {
+		t.Error("registering the same counter twice should return the existing one")
+	}
+	h := r.Histogram("latency_seconds", "", []float64{0.1, 1})
+	if r.Histogram("latency_seconds", "", []float64{1, 0.1}) != h {
+		t.Error("registering the same histogram twice should return the existing one")
+	}
+
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"different type", func() { r.Gauge("hits_total", "", "code") }},
+		{"different labels", func() { r.Counter("hits_total", "", "method") }},
+		{"different buckets", func() { r.Histogram("latency_seconds", "", []float64{0.5}) }},
+		{"default buckets", func() { r.Histogram("latency_seconds", "", nil) }},
+		{"invalid name", func() { r.Counter("0bad", "") }},
+		{"wrong label count", func() { a.Inc() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
+
+func TestCaches(t *testing.T) {
+	users := cache.New[string, int]()
+	users.Set("a", 1)
+	users.Get("a")
+	users.Get("b")
+	users.Get("c")
+
+	caches := cache.NewRegistry()
+	cache.Register(caches, "users", users)
+
+	r := NewRegistry()
+	r.Caches(caches)
+
+	got := scrape(t, r)
+	for _, line := range []string{
+		`armory_cache_hits_total{cache="users"} 1`,
+		`armory_cache_misses_total{cache="users"} 2`,
+		`armory_cache_entries{cache="users"} 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, got)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat selects how AccessLogger renders entries.
+type AccessLogFormat int
+
+const (
+	FormatJSON     AccessLogFormat = iota // One JSON object per line via slog.JSONHandler.
+	FormatCommon                          // Apache Common Log Format, values escaped the way Apache does.
+	FormatCombined                        // Apache Combined Log Format, CLF plus referer and user agent.
+	FormatLogfmt                          // key=value pairs.
+)
+
+// Access log field names, used to pick and order fields for FormatJSON and FormatLogfmt.
+const (
+	FieldTime       = "time"
+	FieldRemoteAddr = "remote_addr"
+	FieldUser       = "user"
+	FieldMethod     = "method"
+	FieldURI        = "uri"
+	FieldProto      = "proto"
+	FieldStatus     = "status"
+	FieldBytes      = "bytes"
+	FieldDuration   = "duration"
+	FieldReferer    = "referer"
+	FieldUserAgent  = "user_agent"
+	FieldRequestID  = "request_id"
+)
+
+// DefaultAccessLogFields are the fields logged by FormatJSON and FormatLogfmt when none are configured.
+var DefaultAccessLogFields = []string{
+	FieldTime, FieldRemoteAddr, FieldUser, FieldMethod, FieldURI, FieldProto, FieldStatus,
+	FieldBytes, FieldDuration, FieldReferer, FieldUserAgent, FieldRequestID,
+}
+
+// AccessLogEntry is a single completed request.
+type AccessLogEntry struct {
+	Time       time.Time // When the request arrived.
+	RemoteAddr string
+	User       string // Basic auth user, empty if none.
+	Method     string
+	URI        string
+	Proto      string
+	Status     int
+	Bytes      int64
+	Duration   time.Duration
+	Referer    string
+	UserAgent  string
+	RequestID  string
+}
+
+// AccessLogOptions configures an AccessLogger.
+type AccessLogOptions struct {
+	Format AccessLogFormat
+	Output io.Writer // Defaults to os.Stdout.
+	Fields []string  // Fields for FormatJSON and FormatLogfmt, defaults to DefaultAccessLogFields.
+	// RedactQuery are query parameters whose values are logged as REDACTED, eg. the
+	// APIKeyOptions.QueryParam, so credentials in URLs don't end up in the log.
+	RedactQuery []string
+}
+
+// AccessLogger writes access log entries in the configured format, one per line.
+type AccessLogger struct {
+	opts AccessLogOptions
+	json slog.Handler
+
+	mu sync.Mutex // keeps concurrent lines from interleaving.
+}
+
+// NewAccessLogger creates an AccessLogger, see AccessLogOptions for the defaults.
+func NewAccessLogger(opts AccessLogOptions) *AccessLogger {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	if len(opts.Fields) == 0 {
+		opts.Fields = DefaultAccessLogFields
+	}
+
+	l := &AccessLogger{opts: opts}
+	if opts.Format == FormatJSON {
+		// A handler serializes its own writes.
+		l.json = slog.NewJSONHandler(opts.Output, nil)
+	}
+	return l
+}
+
+// Log writes e.
+func (l *AccessLogger) Log(e AccessLogEntry) error {
+	e.URI = redactQuery(e.URI, l.opts.RedactQuery)
+	if l.json != nil {
+		// A record without a time leaves the time key to Fields, which logs when the request arrived.
+		r := slog.NewRecord(time.Time{}, slog.LevelInfo, "access", 0)
+		for _, f := range l.opts.Fields {
+			r.AddAttrs(slog.Any(f, e.field(f)))
+		}
+		return l.json.Handle(context.Background(), r)
+	}
+
+	var line string
+	switch l.opts.Format {
+	case FormatCommon:
+		line = e.common() + "\n"
+	case FormatCombined:
+		line = fmt.Sprintf(`%s "%s" "%s"`+"\n", e.common(), escapeLogItem(dash(e.Referer)), escapeLogItem(dash(e.UserAgent)))
+	case FormatLogfmt:
+		line = e.logfmt(l.opts.Fields) + "\n"
+	default:
+		return fmt.Errorf("unknown access log format %d", l.opts.Format)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := io.WriteString(l.opts.Output, line)
+	return err
+}
+
+// redactQuery replaces the values of params in the query of uri, keeping everything else as sent.
+func redactQuery(uri string, params []string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok || len(params) == 0 {
+		return uri
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if slices.Contains(params, name) {
+			pairs[i] = name + "=REDACTED"
+		}
+	}
+	return path + "?" + strings.Join(pairs, "&")
+}
+
+// common renders the entry in Common Log Format: host ident user [time] "request" status bytes.
+func (e AccessLogEntry) common() string {
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		escapeLogItem(dash(e.RemoteAddr)), escapeLogItem(dash(e.User)), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeLogItem(e.Method), escapeLogItem(e.URI), escapeLogItem(e.Proto), e.Status, size)
+}
+
+// escapeLogItem escapes s like Apache's ap_escape_logitem, so client supplied values can't
+// break out of their quotes or forge lines: quotes and backslashes get a backslash, control
+// and non-ASCII bytes become \xhh, or \n, \t and the like where C has a short form.
+func escapeLogItem(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\b':
+			b.WriteString(`\b`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\v':
+			b.WriteString(`\v`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (e AccessLogEntry) logfmt(fields []string) string {
+	var b strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f)
+		b.WriteByte('=')
+
+		var v string
+		switch val := e.field(f).(type) {
+		case time.Time:
+			v = val.Format(time.RFC3339Nano)
+		default:
+			v = fmt.Sprint(val)
+		}
+		if v == "" || strings.ContainsAny(v, " =\"\\\n\t") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+// field returns the value of the named field, nil for unknown names.
+func (e AccessLogEntry) field(name string) any {
+	switch name {
+	case FieldTime:
+		return e.Time
+	case FieldRemoteAddr:
+		return e.RemoteAddr
+	case FieldUser:
+		return e.User
+	case FieldMethod:
+		return e.Method
+	case FieldURI:
+		return e.URI
+	case FieldProto:
+		return e.Proto
+	case FieldStatus:
+		return e.Status
+	case FieldBytes:
+		return e.Bytes
+	case FieldDuration:
+		return e.Duration
+	case FieldReferer:
+		return e.Referer
+	case FieldUserAgent:
+		return e.UserAgent
+	case FieldRequestID:
+		return e.RequestID
+	}
+	return nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
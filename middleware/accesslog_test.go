@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAccessLoggerFormats(t *testing.T) {
+	e := AccessLogEntry{
+		Time:       time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		RemoteAddr: "127.0.0.1",
+		User:       "frank",
+		Method:     http.MethodGet,
+		URI:        "/apache_pb.gif",
+		Proto:      "HTTP/1.0",
+		Status:     200,
+		Bytes:      2326,
+		Duration:   1500 * time.Millisecond,
+		Referer:    "http://www.example.com/start.html",
+		UserAgent:  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+		RequestID:  "req-1",
+	}
+
+	tests := []struct {
+		name string
+		opts AccessLogOptions
+		want string
+	}{
+		{"common", AccessLogOptions{Format: FormatCommon},
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326` + "\n"},
+		{"combined", AccessLogOptions{Format: FormatCombined},
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"` + "\n"},
+		{"logfmt fields", AccessLogOptions{Format: FormatLogfmt, Fields: []string{FieldMethod, FieldStatus, FieldDuration, FieldUserAgent}},
+			`method=GET status=200 duration=1.5s user_agent="Mozilla/4.08 [en] (Win98; I ;Nav)"` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tt.opts.Output = &out
+			if err := NewAccessLogger(tt.opts).Log(e); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got  %s\nwant %s", out.String(), tt.want)
+			}
+		})
+	}
+
+	t.Run("common empty values", func(t *testing.T) {
+		var out bytes.Buffer
+		NewAccessLogger(AccessLogOptions{Format: FormatCommon, Output: &out}).Log(AccessLogEntry{
+			Time: e.Time, RemoteAddr: "10.0.0.1", Method: http.MethodHead, URI: "/", Proto: "HTTP/1.1", Status: 204,
+		})
+		want := `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "HEAD / HTTP/1.1" 204 -` + "\n"
+		if out.String() != want {
+			t.Errorf("got  %s\nwant %s", out.String(), want)
+		}
+	})
+
+	t.Run("combined escapes client values", func(t *testing.T) {
+		var out bytes.Buffer
+		NewAccessLogger(AccessLogOptions{Format: FormatCombined, Output: &out}).Log(AccessLogEntry{
+			Time: e.Time, RemoteAddr: "10.0.0.1", User: "eve\n10.0.0.2 - admin", Method: http.MethodGet,
+			URI: `/a"b\c`, Proto: "HTTP/1.1", Status: 200, UserAgent: "bot\x00\xff",
+		})
+		want := `10.0.0.1 - eve\n10.0.0.2 - admin [10/Oct/2000:13:55:36 -0700] "GET /a\"b\\c HTTP/1.1" 200 - "-" "bot\x00\xff"` + "\n"
+		if out.String() != want {
+			t.Errorf("got  %s\nwant %s", out.String(), want)
+		}
+	})
+
+	t.Run("redacted query", func(t *testing.T) {
+		var out bytes.Buffer
+		NewAccessLogger(AccessLogOptions{Format: FormatLogfmt, Output: &out, Fields: []string{FieldURI}, RedactQuery: []string{"api_key"}}).Log(AccessLogEntry{
+			URI: "/orders?page=2&api_key=secret&api%5Fkey=again",
+		})
+		want := `uri="/orders?page=2&api_key=REDACTED&api_key=REDACTED"` + "\n"
+		if out.String() != want {
+			t.Errorf("got  %s\nwant %s", out.String(), want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		NewAccessLogger(AccessLogOptions{Output: &out, Fields: []string{FieldTime, FieldURI, FieldStatus, FieldRequestID}}).Log(e)
+
+		var got map[string]any
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("invalid json %q: %v", out.String(), err)
+		}
+		if got["uri"] != "/apache_pb.gif" || got["status"] != float64(200) || got["request_id"] != "req-1" {
+			t.Errorf("unexpected entry %v", got)
+		}
+		if want := e.Time.Format(time.RFC3339Nano); got["time"] != want {
+			t.Errorf("time = %v, want the request time %s", got["time"], want)
+		}
+		if _, ok := got["user_agent"]; ok {
+			t.Errorf("unselected field logged: %v", got)
+		}
+	})
+}
+
+func TestLoggingMiddlewareAccessLogger(t *testing.T) {
+	var out, logs bytes.Buffer
+	cfg := &Config{
+		logger:    slog.New(slog.NewJSONHandler(&logs, nil)),
+		accessLog: NewAccessLogger(AccessLogOptions{Format: FormatLogfmt, Output: &out, Fields: []string{FieldRemoteAddr, FieldUser, FieldURI, FieldStatus, FieldBytes}}),
+	}
+	h := cfg.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/items?x=1", nil)
+	req.SetBasicAuth("alice", "secret")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := `remote_addr=192.0.2.1 user=alice uri="/items?x=1" status=201 bytes=5` + "\n"
+	if out.String() != want {
+		t.Errorf("got  %s\nwant %s", out.String(), want)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("slog logger used alongside the access log: %s", logs.String())
+	}
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ErrKeyNotFound is returned by a KeyStore when no key matches.
+var ErrKeyNotFound = errors.New("api key not found")
+
+// Principal is the authenticated caller, attached to the request context by the auth middleware.
+type Principal struct {
+	ID     string
+	Scopes []string
+	Roles  []string
+}
+
+// PrincipalFromContext returns the principal attached by the auth middleware.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok
+}
+
+// APIKey is a stored API key. Only the hash of the key is kept, see HashAPIKey.
+type APIKey struct {
+	Hash      string   `json:"hash"` // Hex encoded SHA-256 of the key.
+	Principal string   `json:"principal"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of key, as stored in APIKey.Hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyStore finds API keys by the SHA-256 of the presented key.
+// Implementations must compare hashes in constant time.
+type KeyStore interface {
+	Find(ctx context.Context, hash [sha256.Size]byte) (APIKey, error)
+}
+
+// MemoryKeyStore is an in-memory KeyStore.
+type MemoryKeyStore struct {
+	mu     sync.RWMutex
+	keys   []APIKey
+	hashes [][sha256.Size]byte
+}
+
+// NewMemoryKeyStore creates a MemoryKeyStore holding keys.
+func NewMemoryKeyStore(keys ...APIKey) (*MemoryKeyStore, error) {
+	s := &MemoryKeyStore{}
+	if err := s.Replace(keys); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Replace swaps the stored keys for keys.
+func (s *MemoryKeyStore) Replace(keys []APIKey) error {
+	hashes := make([][sha256.Size]byte, len(keys))
+	for i, key := range keys {
+		b, err := hex.DecodeString(key.Hash)
+		if err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("api key for %q: hash must be a hex encoded SHA-256", key.Principal)
+		}
+		copy(hashes[i][:], b)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = keys
+	s.hashes = hashes
+	return nil
+}
+
+// Find compares hash against every stored key without returning early, so the time taken
+// doesn't reveal how close a guess was or where a key is stored.
+func (s *MemoryKeyStore) Find(ctx context.Context, hash [sha256.Size]byte) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	match := -1
+	for i := range s.hashes {
+		if subtle.ConstantTimeCompare(s.hashes[i][:], hash[:]) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return APIKey{}, ErrKeyNotFound
+	}
+	return s.keys[match], nil
+}
+
+// FileKeyStore is a KeyStore loaded from a JSON file holding an array of APIKey.
+type FileKeyStore struct {
+	MemoryKeyStore
+	path string
+}
+
+// NewFileKeyStore loads the keys in path.
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload re-reads the file, eg. after keys were added or revoked. On error the old keys are kept.
+func (s *FileKeyStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("failed to parse key file: %w", err)
+	}
+	return s.Replace(keys)
+}
+
+// APIKeyOptions configures APIKeyMiddleware.
+type APIKeyOptions struct {
+	Store  KeyStore
+	Header string // Header carrying the key, defaults to X-API-Key.
+	// QueryParam is a query parameter carrying the key, disabled when empty. Keys in URLs end up in
+	// access logs, list it in AccessLogOptions.RedactQuery, in ResponseCache keys, proxy logs and
+	// browser history, prefer Header where clients can set one.
+	QueryParam string
+}
+
+// APIKeyMiddleware authenticates requests by API key and attaches the key's principal and scopes
+// to the request context, see PrincipalFromContext. Requests without a valid key get a 401.
+func APIKeyMiddleware(opts APIKeyOptions) func(http.Handler) http.Handler {
+	if opts.Header == "" {
+		opts.Header = "X-API-Key"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(opts.Header)
+			if key == "" && opts.QueryParam != "" {
+				key = r.URL.Query().Get(opts.QueryParam)
+			}
+			if key == "" {
+				http.Error(w, "missing api key", http.StatusUnauthorized)
+				return
+			}
+
+			found, err := opts.Store.Find(r.Context(), sha256.Sum256([]byte(key)))
+			if errors.Is(err, ErrKeyNotFound) {
+				http.Error(w, "invalid api key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, "failed to check api key", http.StatusInternalServerError)
+				return
+			}
+
+			p := &Principal{ID: found.Principal, Scopes: found.Scopes, Roles: found.Roles}
+			ctx := context.WithValue(r.Context(), principalKey, p)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
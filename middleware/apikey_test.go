@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	store, err := NewMemoryKeyStore(
+		APIKey{Hash: HashAPIKey("key-billing"), Principal: "billing", Scopes: []string{"invoices:read"}},
+		APIKey{Hash: HashAPIKey("key-search"), Principal: "search"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := APIKeyMiddleware(APIKeyOptions{Store: store, QueryParam: "api_key"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			t.Error("principal missing from context")
+			return
+		}
+		if p.ID == "billing" && !slices.Equal(p.Scopes, []string{"invoices:read"}) {
+			t.Errorf("Scopes = %v", p.Scopes)
+		}
+		w.Write([]byte(p.ID))
+	}))
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		status int
+		want   string
+	}{
+		{"header", "/", "key-billing", http.StatusOK, "billing"},
+		{"query", "/?api_key=key-search", "", http.StatusOK, "search"},
+		{"header wins over query", "/?api_key=key-search", "key-billing", http.StatusOK, "billing"},
+		{"missing", "/", "", http.StatusUnauthorized, ""},
+		{"unknown", "/", "key-nope", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.want {
+				t.Errorf("principal = %q, want %q", rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	write := func(keys ...APIKey) {
+		data, _ := json.Marshal(keys)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(APIKey{Hash: HashAPIKey("k1"), Principal: "one"})
+	store, err := NewFileKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := APIKeyMiddleware(APIKeyOptions{Store: store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if got := status("k1"); got != http.StatusOK {
+		t.Errorf("k1 status = %d, want 200", got)
+	}
+
+	write(APIKey{Hash: HashAPIKey("k2"), Principal: "two"})
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := status("k1"); got != http.StatusUnauthorized {
+		t.Errorf("revoked k1 status = %d, want 401", got)
+	}
+	if got := status("k2"); got != http.StatusOK {
+		t.Errorf("k2 status = %d, want 200", got)
+	}
+
+	write(APIKey{Hash: "not-hex", Principal: "broken"})
+	if err := store.Reload(); err == nil {
+		t.Error("Reload() accepted an invalid hash")
+	}
+	if got := status("k2"); got != http.StatusOK {
+		t.Errorf("k2 status after failed reload = %d, want 200", got)
+	}
+}
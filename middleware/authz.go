@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// RequireScopes only lets requests through whose principal holds every one of scopes.
+// Requests without a principal get a 401 and those missing a scope a 403, both with a problem details body.
+// Token authenticated callers missing a scope also get the RFC 6750 insufficient_scope challenge.
+// It must run after the auth middleware, eg. Chain{AuthMiddleware(opts), RequireScopes("orders:write")}.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return require(func(p *Principal) []string {
+		var missing []string
+		for _, s := range scopes {
+			if !slices.Contains(p.Scopes, s) {
+				missing = append(missing, s)
+			}
+		}
+		return missing
+	}, "missing scopes", true)
+}
+
+// RequireRoles only lets requests through whose principal holds at least one of roles.
+// Like RequireScopes without scopes, it lets any principal through when given no roles.
+// Responses are the same as for RequireScopes, minus the challenge, roles aren't OAuth scopes.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return require(func(p *Principal) []string {
+		if len(roles) == 0 || slices.ContainsFunc(p.Roles, func(role string) bool { return slices.Contains(roles, role) }) {
+			return nil
+		}
+		return roles
+	}, "requires one of roles", false)
+}
+
+// require rejects requests for which missing returns anything, challenge adds the insufficient_scope challenge.
+func require(missing func(*Principal) []string, reason string, challenge bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				WriteProblem(w, Problem{
+					Status:   http.StatusUnauthorized,
+					Detail:   "request is not authenticated",
+					Instance: r.URL.Path,
+				})
+				return
+			}
+
+			if m := missing(p); len(m) > 0 {
+				if _, ok := ClaimsFromContext(r.Context()); ok && challenge {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(m, " ")))
+				}
+				WriteProblem(w, Problem{
+					Status:   http.StatusForbidden,
+					Detail:   fmt.Sprintf("%s: %s", reason, strings.Join(m, ", ")),
+					Instance: r.URL.Path,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
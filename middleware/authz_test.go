@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireScopesAndRoles(t *testing.T) {
+	store, err := NewMemoryKeyStore(
+		APIKey{Hash: HashAPIKey("reader"), Principal: "reader", Scopes: []string{"orders:read"}, Roles: []string{"viewer"}},
+		APIKey{Hash: HashAPIKey("writer"), Principal: "writer", Scopes: []string{"orders:read", "orders:write"}, Roles: []string{"editor"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := APIKeyMiddleware(APIKeyOptions{Store: store})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name   string
+		chain  Chain
+		key    string
+		status int
+	}{
+		{"scopes granted", Chain{auth, RequireScopes("orders:read", "orders:write")}, "writer", http.StatusOK},
+		{"scope missing", Chain{auth, RequireScopes("orders:read", "orders:write")}, "reader", http.StatusForbidden},
+		{"any role", Chain{auth, RequireRoles("admin", "editor")}, "writer", http.StatusOK},
+		{"role missing", Chain{auth, RequireRoles("admin", "editor")}, "reader", http.StatusForbidden},
+		{"no roles", Chain{auth, RequireRoles()}, "reader", http.StatusOK},
+		{"no scopes", Chain{auth, RequireScopes()}, "reader", http.StatusOK},
+		{"stacked", Chain{auth, RequireScopes("orders:read"), RequireRoles("editor")}, "reader", http.StatusForbidden},
+		{"no auth middleware", Chain{RequireScopes("orders:read")}, "writer", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.Header.Set("X-API-Key", tt.key)
+			rec := httptest.NewRecorder()
+			tt.chain.Then(ok).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var p Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatalf("invalid problem body: %v", err)
+			}
+			if p.Status != tt.status || p.Instance != "/orders" || p.Title == "" {
+				t.Errorf("problem = %+v", p)
+			}
+		})
+	}
+}
+
+func TestRequireScopesWithJWT(t *testing.T) {
+	keys := newTestKeys(t)
+	auth := AuthMiddleware(JWTOptions{Keys: keys.source()})
+	exp := time.Now().Add(time.Minute).Unix()
+
+	tests := []struct {
+		name      string
+		require   func(http.Handler) http.Handler
+		claims    map[string]any
+		status    int
+		challenge string
+	}{
+		{"scope string", RequireScopes("a", "b"), map[string]any{"sub": "u", "exp": exp, "scope": "a b"}, http.StatusOK, ""},
+		{"scp array", RequireScopes("a", "b"), map[string]any{"sub": "u", "exp": exp, "scp": []string{"a", "b"}}, http.StatusOK, ""},
+		{"missing scope", RequireScopes("a", "b"), map[string]any{"sub": "u", "exp": exp, "scope": "a"}, http.StatusForbidden, `Bearer error="insufficient_scope", scope="b"`},
+		{"missing role", RequireRoles("admin"), map[string]any{"sub": "u", "exp": exp, "roles": []string{"viewer"}}, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+signJWT(t, HS256, "hs", keys.secret, tt.claims))
+			rec := httptest.NewRecorder()
+			Chain{auth, tt.require}.ThenFunc(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+		})
+	}
+}
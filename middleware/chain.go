@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Chain slice of middleware funcs to be applied using slice.Backward(middleware is applied starting from last to first element).
+// The first middleware in the chain is the outermost, it sees the request first and the response last.
+type Chain []func(http.Handler) http.Handler
+
+// ThenFunc wraps h in the chain.
+func (c Chain) ThenFunc(h http.HandlerFunc) http.Handler {
+	return c.Then(h)
+}
+
+// Then wraps h in the chain.
+func (c Chain) Then(h http.Handler) http.Handler {
+	for _, mw := range slices.Backward(c) {
+		h = mw(h)
+	}
+	return h
+}
+
+// Append returns a new chain with mws run after the middleware in c.
+// Unlike the builtin append, c is never modified, so chains can safely share a base.
+func (c Chain) Append(mws ...func(http.Handler) http.Handler) Chain {
+	return append(slices.Clip(c), mws...)
+}
+
+// Extend returns a new chain with the middleware of other run after the middleware in c.
+func (c Chain) Extend(other Chain) Chain {
+	return c.Append(other...)
+}
+
+// Handle registers h wrapped in the chain on mux for pattern, eg. "POST /orders/{id}".
+func (c Chain) Handle(mux *http.ServeMux, pattern string, h http.Handler) {
+	mux.Handle(pattern, c.Then(h))
+}
+
+// HandleFunc registers h wrapped in the chain on mux for pattern.
+func (c Chain) HandleFunc(mux *http.ServeMux, pattern string, h http.HandlerFunc) {
+	mux.Handle(pattern, c.Then(h))
+}
+
+// When applies mw only to requests for which pred returns true, the others skip it.
+// eg. When(func(r *http.Request) bool { return r.Method != http.MethodGet }, auth)
+func When(pred func(*http.Request) bool, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pred(r) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tag returns middleware that appends name to the X-Order response header on the way in.
+func tag(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Order", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func order(h http.Handler, method, target string) string {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return strings.Join(rec.Header().Values("X-Order"), ",")
+}
+
+func TestChain(t *testing.T) {
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Header().Add("X-Order", "handler") })
+
+	base := make(Chain, 0, 4) // spare capacity, where the builtin append would alias.
+	base = append(base, tag("a"), tag("b"))
+	withC := base.Append(tag("c"))
+	withD := base.Append(tag("d"))
+	extended := base.Extend(Chain{tag("e"), tag("f")})
+
+	tests := []struct {
+		name  string
+		chain Chain
+		want  string
+	}{
+		{"empty", Chain{}, "handler"},
+		{"first is outermost", base, "a,b,handler"},
+		{"append", withC, "a,b,c,handler"},
+		{"append doesn't alias", withD, "a,b,d,handler"},
+		{"extend", extended, "a,b,e,f,handler"},
+		{"base unchanged", base, "a,b,handler"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := order(tt.chain.ThenFunc(final), http.MethodGet, "/"); got != tt.want {
+				t.Errorf("order = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhen(t *testing.T) {
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	writes := func(r *http.Request) bool { return r.Method != http.MethodGet }
+	h := Chain{tag("a"), When(writes, tag("auth")), tag("b")}.Then(final)
+
+	if got := order(h, http.MethodGet, "/"); got != "a,b" {
+		t.Errorf("GET order = %s, want a,b", got)
+	}
+	if got := order(h, http.MethodPost, "/"); got != "a,auth,b" {
+		t.Errorf("POST order = %s, want a,auth,b", got)
+	}
+}
+
+func TestChainHandle(t *testing.T) {
+	mux := http.NewServeMux()
+	admin := Chain{tag("admin")}
+	admin.HandleFunc(mux, "DELETE /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "delete "+r.PathValue("id"))
+	})
+	Chain{}.Handle(mux, "GET /items/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "get "+r.PathValue("id"))
+	}))
+
+	if got := order(mux, http.MethodDelete, "/items/7"); got != "admin,delete 7" {
+		t.Errorf("DELETE order = %s", got)
+	}
+	if got := order(mux, http.MethodGet, "/items/7"); got != "get 7" {
+		t.Errorf("GET order = %s", got)
+	}
+}
@@ -0,0 +1,292 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressOptions configures Compress.
+type CompressOptions struct {
+	// Level is a compress/flate level, eg. flate.BestSpeed. Defaults to flate.DefaultCompression.
+	Level int
+	// MinSize is the body size below which responses are sent as is, compressing small
+	// bodies costs more than it saves. Defaults to 1KB.
+	MinSize int
+	// ContentTypes are the media types compressed, "text/*" matches a whole type.
+	// Defaults to text, JSON, JavaScript, XML and SVG.
+	ContentTypes []string
+}
+
+// DefaultCompressTypes are the media types Compress compresses when none are configured.
+var DefaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// encoder is what gzip.Writer and zlib.Writer have in common.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compress compresses response bodies with gzip or deflate, whichever the client prefers by the
+// q-values in Accept-Encoding. Bodies shorter than MinSize, of a type not in ContentTypes, already
+// encoded, partial (206) or without content are sent as is. Up to MinSize bytes are buffered to decide,
+// flushing the response decides early, so streamed responses are compressed and flushed as they go.
+func Compress(opts CompressOptions) func(http.Handler) http.Handler {
+	if opts.Level == 0 {
+		opts.Level = flate.DefaultCompression
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1024
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultCompressTypes
+	}
+
+	// Validate the level once, so the pools never hand out nil writers.
+	if _, err := gzip.NewWriterLevel(io.Discard, opts.Level); err != nil {
+		panic("middleware: " + err.Error())
+	}
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, opts.Level)
+			return w
+		}},
+		// deflate in HTTP is the zlib format, RFC 9110 section 8.4.1.2, not raw flate output.
+		"deflate": {New: func() any {
+			w, _ := zlib.NewWriterLevel(io.Discard, opts.Level)
+			return w
+		}},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Values("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, opts: &opts, encoding: encoding, pool: pools[encoding]}
+			// When next panics, finishing the response would send a 200 RecoverMiddleware can't replace.
+			defer cw.release()
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// negotiateEncoding returns the supported encoding with the highest q-value in the
+// Accept-Encoding values, preferring gzip on ties, or "" when neither is acceptable.
+func negotiateEncoding(values []string) string {
+	q := map[string]float64{}
+	for _, v := range values {
+		for item := range strings.SplitSeq(v, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "x-gzip" {
+				name = "gzip"
+			}
+			weight := 1.0
+			if k, val, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+				f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+				if err != nil || f < 0 || f > 1 {
+					continue
+				}
+				weight = f
+			}
+			q[name] = weight
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range []string{"gzip", "deflate"} {
+		w, ok := q[enc]
+		if !ok {
+			w = q["*"] // zero when absent too.
+		}
+		if w > bestQ {
+			best, bestQ = enc, w
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of the body to decide whether to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	opts     *CompressOptions
+	encoding string
+	pool     *sync.Pool
+
+	buf      []byte
+	status   int
+	decided  bool
+	compress bool
+	enc      encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	// Informational responses, eg. 103 Early Hints, may precede the final status.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status == 0 {
+		cw.status = code
+	}
+	if !bodyAllowed(code) {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if len(cw.buf)+len(b) < cw.opts.MinSize {
+			cw.buf = append(cw.buf, b...)
+			return len(b), nil
+		}
+		cw.buf = append(cw.buf, b...)
+		return len(b), cw.decide(false)
+	}
+	if cw.compress {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush decides on compression if still undecided, regardless of MinSize, and flushes
+// the encoder and the underlying writer.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if err := cw.decide(true); err != nil {
+			return
+		}
+	}
+	if cw.compress {
+		if err := cw.enc.Flush(); err != nil {
+			return
+		}
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide picks compression, sends the headers and writes out the buffered body.
+// streaming skips the MinSize check.
+func (cw *compressWriter) decide(streaming bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	if bodyAllowed(cw.status) && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" &&
+		cw.status != http.StatusPartialContent && (streaming || len(cw.buf) >= cw.opts.MinSize) {
+		ct := h.Get("Content-Type")
+		if ct == "" && len(cw.buf) > 0 {
+			// net/http would sniff the type of the uncompressed body, do it before compressing it.
+			ct = http.DetectContentType(cw.buf)
+			h.Set("Content-Type", ct)
+		}
+		cw.compress = cw.allowedType(ct)
+	}
+
+	if cw.compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		// The compressed body is a different representation, a strong ETag would claim byte equality.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.enc = cw.pool.Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	var err error
+	if cw.compress {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close sends a body shorter than MinSize as is, or finishes the compressed stream.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return // nothing written, leave the implicit 200 to net/http.
+		}
+		cw.decide(false)
+	}
+	if cw.compress {
+		cw.enc.Close()
+	}
+}
+
+// release returns the encoder to the pool without writing anything.
+func (cw *compressWriter) release() {
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Reset(io.Discard) // don't keep the response writer alive in the pool.
+	cw.pool.Put(cw.enc)
+	cw.enc = nil
+}
+
+func (cw *compressWriter) allowedType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range cw.opts.ContentTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mt, prefix+"/") {
+				return true
+			}
+		} else if mt == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyAllowed reports whether a response with status may have a body.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified &&
+		(status < 100 || status >= 200)
+}
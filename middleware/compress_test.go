@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"br", ""},
+		{"*", "gzip"},
+		{"*;q=0.1, gzip;q=0", "deflate"},
+		{"identity", ""},
+		{"x-gzip", "gzip"},
+		{"GZIP ; q=0.8", "gzip"},
+		{"gzip;q=2, deflate;q=0.3", "deflate"},
+		{"gzip;q=abc", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding([]string{tt.header}); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+	if err != nil {
+		t.Fatalf("invalid %s body: %v", encoding, err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("invalid %s body: %v", encoding, err)
+	}
+	return string(b)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"id":1,"name":"widget"},`, 100)
+
+	tests := []struct {
+		name     string
+		accept   string
+		method   string
+		handler  http.HandlerFunc
+		encoding string // expected Content-Encoding.
+		body     string
+		length   string // expected Content-Length.
+	}{
+		{"gzip json", "gzip", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "2500")
+			io.WriteString(w, large)
+		}, "gzip", large, ""},
+		{"deflate", "deflate", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, large)
+		}, "deflate", large, ""},
+		{"many small writes", "gzip", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			for range 200 {
+				io.WriteString(w, "0123456789")
+			}
+		}, "gzip", strings.Repeat("0123456789", 200), ""},
+		{"sniffed type", "gzip", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "<html>"+strings.Repeat("a", 2000))
+		}, "gzip", "<html>" + strings.Repeat("a", 2000), ""},
+		{"below min size", "gzip", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "2")
+			io.WriteString(w, "{}")
+		}, "", "{}", "2"},
+		{"type not allowed", "gzip", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, large)
+		}, "", large, ""},
+		{"already encoded", "gzip", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "br")
+			io.WriteString(w, large)
+		}, "br", large, ""},
+		{"partial content", "gzip", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Range", "bytes 0-2499/5000")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, large)
+		}, "", large, ""},
+		{"not accepted", "br", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, large)
+		}, "", large, ""},
+		{"no content", "gzip", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}, "", "", ""},
+		{"head", "gzip", http.MethodHead, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "2500")
+		}, "", "", "2500"},
+	}
+
+	h := Compress(CompressOptions{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Twice, so that the second run gets a pooled writer.
+			for range 2 {
+				req := httptest.NewRequest(tt.method, "/", nil)
+				req.Header.Set("Accept-Encoding", tt.accept)
+				rec := httptest.NewRecorder()
+				h(tt.handler).ServeHTTP(rec, req)
+
+				if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+					t.Fatalf("Content-Encoding = %q, want %q", got, tt.encoding)
+				}
+				if got := rec.Header().Get("Content-Length"); got != tt.length {
+					t.Errorf("Content-Length = %q, want %q", got, tt.length)
+				}
+				if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+					t.Errorf("Vary = %q, want Accept-Encoding", got)
+				}
+				if got := decode(t, rec.Header().Get("Content-Encoding"), rec.Body.Bytes()); got != tt.body {
+					t.Errorf("body = %.40q..., want %.40q...", got, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressETag(t *testing.T) {
+	h := Compress(CompressOptions{MinSize: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, "hello")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("ETag"); got != `W/"v1"` {
+		t.Errorf("ETag = %s, want the weak W/\"v1\"", got)
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	cfg := &Config{logger: slog.New(slog.DiscardHandler)}
+	h := cfg.RecoverMiddleware(Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"partial":`)
+		panic("boom")
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	// The buffered start of the body must be dropped, not sent as a 200.
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "partial") {
+		t.Errorf("got %d %q, want RecoverMiddleware's 500", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	flushed := make(chan []byte, 1)
+	var rec *httptest.ResponseRecorder
+
+	h := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush() error = %v", err)
+		}
+		flushed <- bytes.Clone(rec.Body.Bytes())
+		io.WriteString(w, "data: second\n\n")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if !rec.Flushed {
+		t.Error("Flush did not reach the underlying writer")
+	}
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("flushed stream below MinSize wasn't compressed")
+	}
+	// The flushed part must already decode to the first event.
+	zr, err := gzip.NewReader(bytes.NewReader(<-flushed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(zr, first); err != nil || string(first) != "data: first\n\n" {
+		t.Errorf("flushed data = %q, %v", first, err)
+	}
+	if got := decode(t, "gzip", rec.Body.Bytes()); got != "data: first\n\ndata: second\n\n" {
+		t.Errorf("body = %q", got)
+	}
+}
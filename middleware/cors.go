@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures CORS.
+type CORSOptions struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests: exact, eg. "https://app.example.com",
+	// a wildcard subdomain, eg. "https://*.example.com", which doesn't match example.com itself, or "*" for any.
+	AllowedOrigins []string
+	// AllowOriginFunc allows origins in addition to AllowedOrigins, eg. from a tenant database.
+	AllowOriginFunc func(r *http.Request, origin string) bool
+	// AllowedMethods may be used in cross-origin requests. Defaults to GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders may be sent in cross-origin requests, "*" allows any.
+	AllowedHeaders []string
+	// ExposedHeaders are response headers scripts may read beyond the CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials lets requests carry cookies and HTTP authentication.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight result, unset when zero.
+	MaxAge time.Duration
+}
+
+// CORS implements cross-origin resource sharing, https://fetch.spec.whatwg.org/#http-cors-protocol.
+// Preflight requests are answered with 204 without calling next, actual requests get the
+// CORS headers and are passed on. Requests from origins that aren't allowed are passed on without
+// CORS headers, the browser then blocks the response, so CORS is no substitute for authorization.
+// Preflights are OPTIONS requests, which routes registered for other methods don't match: wrap the
+// Router or ServeMux in CORS, eg. CORS(opts)(r), not a Router group, whose middleware never sees them.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+
+	var exact []string
+	var wildcards [][2]string // scheme://, .domain
+	anyOrigin := false
+	for _, o := range opts.AllowedOrigins {
+		o = strings.ToLower(o)
+		switch {
+		case o == "*":
+			anyOrigin = true
+		case strings.Contains(o, "://*."):
+			scheme, domain, _ := strings.Cut(o, "*")
+			wildcards = append(wildcards, [2]string{scheme, domain})
+		default:
+			exact = append(exact, o)
+		}
+	}
+	anyHeader := slices.Contains(opts.AllowedHeaders, "*")
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	exposed := strings.Join(opts.ExposedHeaders, ", ")
+
+	allowed := func(r *http.Request, origin string) bool {
+		if anyOrigin {
+			return true
+		}
+		o := strings.ToLower(origin)
+		if slices.Contains(exact, o) {
+			return true
+		}
+		for _, w := range wildcards {
+			if strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) && len(o) > len(w[0])+len(w[1]) {
+				return true
+			}
+		}
+		return opts.AllowOriginFunc != nil && opts.AllowOriginFunc(r, origin)
+	}
+
+	// "*" can't be combined with credentials, and a response that depends on the origin must say so.
+	allowOrigin := func(h http.Header, origin string) {
+		if anyOrigin && !opts.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", origin)
+		if opts.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+	varyOrigin := !anyOrigin || opts.AllowCredentials
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if preflight {
+				h.Add("Vary", "Origin")
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			} else if varyOrigin {
+				h.Add("Vary", "Origin")
+			}
+
+			if origin == "" || !allowed(r, origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !preflight {
+				allowOrigin(h, origin)
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// A failed preflight gets no CORS headers, which is how the browser learns it failed.
+			if !slices.Contains(opts.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			requested := parseHeaderList(r.Header.Values("Access-Control-Request-Headers"))
+			if !anyHeader {
+				for _, name := range requested {
+					if !slices.ContainsFunc(opts.AllowedHeaders, func(a string) bool { return strings.EqualFold(a, name) }) {
+						w.WriteHeader(http.StatusNoContent)
+						return
+					}
+				}
+			}
+
+			allowOrigin(h, origin)
+			h.Set("Access-Control-Allow-Methods", methods)
+			if len(requested) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+			}
+			if opts.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// parseHeaderList splits comma separated header names, eg. Access-Control-Request-Headers.
+func parseHeaderList(values []string) []string {
+	var names []string
+	for _, v := range values {
+		for name := range strings.SplitSeq(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, strings.ToLower(name))
+			}
+		}
+	}
+	return names
+}
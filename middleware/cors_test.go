@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	defaults := CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.tenant.example"},
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			return origin == "https://partner.example"
+		},
+		AllowedMethods: []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders: []string{"Content-Type", "X-Request-ID"},
+		ExposedHeaders: []string{"X-Request-ID", "RateLimit-Remaining"},
+		MaxAge:         10 * time.Minute,
+	}
+	credentials := defaults
+	credentials.AllowCredentials = true
+	wildcard := CORSOptions{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}}
+	wildcardCredentials := CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+
+	preflight := func(origin, method, headers string) http.Header {
+		h := http.Header{"Origin": {origin}, "Access-Control-Request-Method": {method}}
+		if headers != "" {
+			h.Set("Access-Control-Request-Headers", headers)
+		}
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		opts    CORSOptions
+		method  string
+		header  http.Header
+		status  int
+		reached bool              // next was called.
+		want    map[string]string // response headers, "" means absent.
+	}{
+		{"no origin", defaults, http.MethodGet, http.Header{}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"}},
+		{"exact origin", defaults, http.MethodGet, http.Header{"Origin": {"https://app.example.com"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Expose-Headers": "X-Request-ID, RateLimit-Remaining", "Access-Control-Allow-Credentials": "", "Vary": "Origin"}},
+		{"wildcard subdomain", defaults, http.MethodGet, http.Header{"Origin": {"https://acme.tenant.example"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "https://acme.tenant.example"}},
+		{"wildcard doesn't match apex", defaults, http.MethodGet, http.Header{"Origin": {"https://tenant.example"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": ""}},
+		{"wildcard checks scheme", defaults, http.MethodGet, http.Header{"Origin": {"http://acme.tenant.example"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": ""}},
+		{"origin func", defaults, http.MethodGet, http.Header{"Origin": {"https://partner.example"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "https://partner.example"}},
+		{"disallowed origin", defaults, http.MethodGet, http.Header{"Origin": {"https://evil.example"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Expose-Headers": ""}},
+		{"credentials", credentials, http.MethodGet, http.Header{"Origin": {"https://app.example.com"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Credentials": "true"}},
+		{"any origin", wildcard, http.MethodGet, http.Header{"Origin": {"https://any.example"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "*", "Vary": ""}},
+		{"any origin with credentials reflects", wildcardCredentials, http.MethodGet, http.Header{"Origin": {"https://any.example"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "https://any.example", "Access-Control-Allow-Credentials": "true", "Vary": "Origin"}},
+
+		{"preflight", defaults, http.MethodOptions, preflight("https://app.example.com", http.MethodPut, "content-type, X-Request-ID"), http.StatusNoContent, false,
+			map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, PUT",
+				"Access-Control-Allow-Headers": "content-type, x-request-id",
+				"Access-Control-Max-Age":       "600",
+				"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+			}},
+		{"preflight method not allowed", defaults, http.MethodOptions, preflight("https://app.example.com", http.MethodDelete, ""), http.StatusNoContent, false,
+			map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""}},
+		{"preflight header not allowed", defaults, http.MethodOptions, preflight("https://app.example.com", http.MethodGet, "X-Secret"), http.StatusNoContent, false,
+			map[string]string{"Access-Control-Allow-Origin": ""}},
+		{"preflight disallowed origin", defaults, http.MethodOptions, preflight("https://evil.example", http.MethodGet, ""), http.StatusNoContent, false,
+			map[string]string{"Access-Control-Allow-Origin": ""}},
+		{"preflight any header", wildcard, http.MethodOptions, preflight("https://any.example", http.MethodPost, "X-Anything"), http.StatusNoContent, false,
+			map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Headers": "x-anything", "Access-Control-Max-Age": ""}},
+		{"plain options", defaults, http.MethodOptions, http.Header{"Origin": {"https://app.example.com"}}, http.StatusOK, true,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Methods": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			h := CORS(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if reached != tt.reached {
+				t.Errorf("next called = %v, want %v", reached, tt.reached)
+			}
+			for name, want := range tt.want {
+				if got := strings.Join(rec.Header().Values(name), ", "); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCrossOriginProtection(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &Config{logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+	mw, err := cfg.CrossOriginProtection(CrossOriginOptions{
+		TrustedOrigins: []string{"https://trusted.example"},
+		InsecureBypass: []string{"POST /webhooks/{provider}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		status int
+	}{
+		{"same origin", http.MethodPost, "/orders", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"non-browser", http.MethodPost, "/orders", nil, http.StatusOK},
+		{"cross-origin get", http.MethodGet, "/orders", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+		{"cross-origin post", http.MethodPost, "/orders", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"trusted origin", http.MethodPost, "/orders", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://trusted.example"}, http.StatusOK},
+		{"bypass", http.MethodPost, "/webhooks/stripe", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://stripe.example"}, http.StatusOK},
+		{"bypass is method specific", http.MethodPut, "/webhooks/stripe", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://stripe.example"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey, "req-1"))
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				if logs.Len() != 0 {
+					t.Errorf("allowed request logged: %s", logs.String())
+				}
+				return
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var p Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.Status != http.StatusForbidden || p.Instance != tt.target {
+				t.Errorf("problem = %+v, %v", p, err)
+			}
+			for _, want := range []string{`"request_id":"req-1"`, `"origin":"https://`, `"reason":`} {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("log missing %s: %s", want, logs.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCrossOriginProtectionOptions(t *testing.T) {
+	cfg := &Config{logger: slog.New(slog.DiscardHandler)}
+
+	if _, err := cfg.CrossOriginProtection(CrossOriginOptions{TrustedOrigins: []string{"trusted.example/path"}}); err == nil {
+		t.Error("malformed trusted origin accepted")
+	}
+	if _, err := cfg.CrossOriginProtection(CrossOriginOptions{InsecureBypass: []string{"POST /hooks/{a", "POST /hooks"}}); err == nil {
+		t.Error("invalid bypass pattern accepted")
+	}
+	if _, err := cfg.CrossOriginProtection(CrossOriginOptions{InsecureBypass: []string{"POST /hooks/{a}", "POST /hooks/{b}"}}); err == nil {
+		t.Error("conflicting bypass patterns accepted")
+	}
+
+	mw, err := cfg.CrossOriginProtection(CrossOriginOptions{
+		DenyHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	rec := httptest.NewRecorder()
+	mw(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("status = %d, want the deny handler's 418", rec.Code)
+	}
+}
@@ -0,0 +1,279 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go-armory/cache"
+)
+
+// JSONWebKey is a verification key parsed from a JWK set, Key has the type expected by KeySource.
+type JSONWebKey struct {
+	Kid string
+	Alg string // Algorithm the key is restricted to, any supported algorithm when empty.
+	Key any
+}
+
+// JWKSOptions configures a JWKS. Exactly one of URL and File must be set.
+type JWKSOptions struct {
+	URL    string       // Location of the JWK set, eg. https://issuer.example/.well-known/jwks.json
+	File   string       // Path of a JWK set on disk.
+	Client *http.Client // Defaults to a client with a 10s timeout.
+
+	// Cache holds the parsed keys by kid. Defaults to an unbounded cache.
+	Cache *cache.Cache[string, JSONWebKey]
+	// MinRefreshInterval is the minimum time between two refreshes triggered by an unknown kid,
+	// so tokens with made up kids can't be used to hammer the identity provider. Defaults to 1m.
+	MinRefreshInterval time.Duration
+	// RefreshInterval is the maximum age of the key set, the next Key call after it reloads the set
+	// so keys the provider revoked stop being trusted. Defaults to 1h.
+	RefreshInterval time.Duration
+	// AllowSymmetricKeys accepts oct (HS256) keys from URL. They are skipped by default: a JWK set
+	// behind a URL is usually public, and anyone who can read a symmetric key can sign tokens with it.
+	// Keys from File are always accepted.
+	AllowSymmetricKeys bool
+}
+
+// refreshTimeout bounds a refresh triggered by a request, which runs detached from the request's
+// context so that a cancelled request can't fail it and hold off the next one for MinRefreshInterval.
+const refreshTimeout = 10 * time.Second
+
+// JWKS is a KeySource that loads keys from a JWK set, RFC 7517, and reloads it when a token
+// refers to a kid it doesn't know, which is how signing key rotation shows up, or once the set
+// is older than RefreshInterval.
+type JWKS struct {
+	opts JWKSOptions
+
+	mu          sync.Mutex // serializes refreshes.
+	lastRefresh time.Time
+	loaded      time.Time // of the last successful refresh.
+	now         func() time.Time
+}
+
+// NewJWKS creates a JWKS. Keys are loaded lazily on first use, call Refresh to load them up front.
+func NewJWKS(opts JWKSOptions) *JWKS {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.Cache == nil {
+		opts.Cache = cache.New[string, JSONWebKey]()
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = time.Minute
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Hour
+	}
+	return &JWKS{opts: opts, now: time.Now}
+}
+
+// Key implements KeySource, refreshing the key set once when kid is unknown or the set is too old.
+func (j *JWKS) Key(ctx context.Context, alg, kid string) (any, error) {
+	if j.expired() {
+		j.refreshLimited(ctx) // on failure the keys loaded before stay in use until the next attempt.
+	}
+	jwk, ok := j.opts.Cache.Get(kid)
+	if !ok {
+		if err := j.refreshLimited(ctx); err != nil {
+			return nil, err
+		}
+		if jwk, ok = j.opts.Cache.Get(kid); !ok {
+			return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+		}
+	}
+	if jwk.Alg != "" && jwk.Alg != alg {
+		return nil, fmt.Errorf("%w: kid %q is restricted to %s", ErrUnknownKey, kid, jwk.Alg)
+	}
+	return jwk.Key, nil
+}
+
+// expired reports whether the loaded key set is older than RefreshInterval.
+func (j *JWKS) expired() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return !j.loaded.IsZero() && j.now().Sub(j.loaded) >= j.opts.RefreshInterval
+}
+
+// refreshLimited reloads the key set unless it was reloaded less than MinRefreshInterval ago.
+func (j *JWKS) refreshLimited(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	defer cancel()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.lastRefresh.IsZero() && j.now().Sub(j.lastRefresh) < j.opts.MinRefreshInterval {
+		return nil
+	}
+	return j.refresh(ctx)
+}
+
+// Refresh reloads the key set, dropping keys that are no longer published.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.refresh(ctx)
+}
+
+// refresh does the actual reload. Caller must hold j.mu.
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.lastRefresh = j.now() // also on failure, a broken endpoint shouldn't be hit on every request.
+
+	data, err := j.load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load JWK set: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	published := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, symmetric := key.Key.([]byte); symmetric && j.opts.URL != "" && !j.opts.AllowSymmetricKeys {
+			continue
+		}
+		j.opts.Cache.Set(key.Kid, key)
+		published[key.Kid] = true
+	}
+	j.opts.Cache.RemoveFunc(func(kid string) bool { return !published[kid] })
+	j.loaded = j.lastRefresh
+	return nil
+}
+
+func (j *JWKS) load(ctx context.Context) ([]byte, error) {
+	switch {
+	case j.opts.URL != "" && j.opts.File != "":
+		return nil, errors.New("both URL and File are set")
+	case j.opts.File != "":
+		return os.ReadFile(j.opts.File)
+	case j.opts.URL == "":
+		return nil, errors.New("neither URL nor File is set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.opts.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := j.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses a JWK set. Keys not meant for signatures, and key types or curves
+// that can't verify HS256, RS256 or ES256 tokens are skipped.
+func ParseJWKS(data []byte) ([]JSONWebKey, error) {
+	var set struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWK set: %w", err)
+	}
+
+	keys := make([]JSONWebKey, 0, len(set.Keys))
+	for _, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		key, err := raw.parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWK %q: %w", raw.Kid, err)
+		}
+		if key == nil {
+			continue
+		}
+		keys = append(keys, JSONWebKey{Kid: raw.Kid, Alg: raw.Alg, Key: key})
+	}
+	return keys, nil
+}
+
+// parse returns the key, or nil if the key type isn't supported.
+func (raw rawJWK) parse() (any, error) {
+	b64 := base64.RawURLEncoding
+
+	switch raw.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(raw.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := b64.DecodeString(raw.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		if raw.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := b64.DecodeString(raw.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := b64.DecodeString(raw.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		// Round trip through the uncompressed point encoding so that points off the curve are rejected.
+		point := append([]byte{4}, append(leftPad(x, 32), leftPad(y, 32)...)...)
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+		if err != nil {
+			return nil, err
+		}
+		return pub, nil
+	case "oct":
+		k, err := b64.DecodeString(raw.K)
+		if err != nil {
+			return nil, fmt.Errorf("k: %w", err)
+		}
+		return k, nil
+	}
+	return nil, nil
+}
+
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
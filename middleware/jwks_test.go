@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": RS256,
+		"n": base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, pub *ecdsa.PublicKey) map[string]string {
+	b, _ := pub.Bytes() // 0x04 || x || y
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(b[1:33]),
+		"y": base64.RawURLEncoding.EncodeToString(b[33:]),
+	}
+}
+
+// jwksServer serves whatever key set was last passed to publish and counts fetches.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) publish(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func TestJWKSVerifiesTokens(t *testing.T) {
+	keys := newTestKeys(t)
+	srv := newJWKSServer(t)
+	srv.publish(rsaJWK("rs", &keys.rsa.PublicKey), ecJWK("es", &keys.ec.PublicKey), map[string]string{"kty": "RSA", "kid": "enc", "use": "enc"})
+
+	opts := JWTOptions{Keys: NewJWKS(JWKSOptions{URL: srv.URL})}
+	claims := map[string]any{"sub": "user-1", "exp": time.Now().Add(time.Minute).Unix()}
+
+	for _, token := range []string{
+		signJWT(t, RS256, "rs", keys.rsa, claims),
+		signJWT(t, ES256, "es", keys.ec, claims),
+	} {
+		if _, err := VerifyJWT(context.Background(), token, opts); err != nil {
+			t.Errorf("VerifyJWT() error = %v", err)
+		}
+	}
+	if n := srv.fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1", n)
+	}
+
+	// The RSA key is restricted to RS256 by its alg member.
+	if _, err := opts.Keys.Key(context.Background(), ES256, "rs"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key() with mismatched alg error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKeys, newKeys := newTestKeys(t), newTestKeys(t)
+	srv := newJWKSServer(t)
+	srv.publish(rsaJWK("old", &oldKeys.rsa.PublicKey))
+
+	jwks := NewJWKS(JWKSOptions{URL: srv.URL, MinRefreshInterval: time.Minute})
+	now := time.Now()
+	jwks.now = func() time.Time { return now }
+	opts := JWTOptions{Keys: jwks}
+	claims := map[string]any{"exp": time.Now().Add(time.Hour).Unix()}
+
+	if _, err := VerifyJWT(context.Background(), signJWT(t, RS256, "old", oldKeys.rsa, claims), opts); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+
+	// The provider rotates, but unknown kids within MinRefreshInterval must not trigger a fetch.
+	srv.publish(rsaJWK("new", &newKeys.rsa.PublicKey))
+	newToken := signJWT(t, RS256, "new", newKeys.rsa, claims)
+	for range 5 {
+		if _, err := VerifyJWT(context.Background(), newToken, opts); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("VerifyJWT() error = %v, want ErrUnknownKey while rate limited", err)
+		}
+	}
+	if n := srv.fetches.Load(); n != 1 {
+		t.Errorf("fetches = %d, want 1 while rate limited", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := VerifyJWT(context.Background(), newToken, opts); err != nil {
+		t.Fatalf("new key after refresh: %v", err)
+	}
+	if _, err := VerifyJWT(context.Background(), signJWT(t, RS256, "old", oldKeys.rsa, claims), opts); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old key should be dropped after rotation, error = %v", err)
+	}
+}
+
+func TestJWKSRefreshInterval(t *testing.T) {
+	keys, other := newTestKeys(t), newTestKeys(t)
+	srv := newJWKSServer(t)
+	srv.publish(rsaJWK("rs", &keys.rsa.PublicKey))
+
+	jwks := NewJWKS(JWKSOptions{URL: srv.URL, RefreshInterval: time.Hour})
+	now := time.Now()
+	jwks.now = func() time.Time { return now }
+
+	if _, err := jwks.Key(context.Background(), RS256, "rs"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider revokes the key, it stays trusted until the set is an hour old.
+	srv.publish(rsaJWK("other", &other.rsa.PublicKey))
+	now = now.Add(30 * time.Minute)
+	if _, err := jwks.Key(context.Background(), RS256, "rs"); err != nil {
+		t.Errorf("Key() before RefreshInterval error = %v", err)
+	}
+	now = now.Add(30 * time.Minute)
+	if _, err := jwks.Key(context.Background(), RS256, "rs"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key() of a revoked key error = %v, want ErrUnknownKey", err)
+	}
+	if n := srv.fetches.Load(); n != 2 {
+		t.Errorf("fetches = %d, want 2", n)
+	}
+}
+
+func TestJWKSSymmetricKeysFromURL(t *testing.T) {
+	secret := base64.RawURLEncoding.EncodeToString([]byte("published-secret"))
+	srv := newJWKSServer(t)
+	srv.publish(map[string]string{"kty": "oct", "kid": "hs", "k": secret})
+
+	if _, err := NewJWKS(JWKSOptions{URL: srv.URL}).Key(context.Background(), HS256, "hs"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key() error = %v, want ErrUnknownKey for an oct key from a URL", err)
+	}
+	if _, err := NewJWKS(JWKSOptions{URL: srv.URL, AllowSymmetricKeys: true}).Key(context.Background(), HS256, "hs"); err != nil {
+		t.Errorf("Key() with AllowSymmetricKeys error = %v", err)
+	}
+}
+
+func TestJWKSRefreshOutlivesRequest(t *testing.T) {
+	keys := newTestKeys(t)
+	srv := newJWKSServer(t)
+	srv.publish(rsaJWK("rs", &keys.rsa.PublicKey))
+
+	// The request is gone already, the refresh it triggers must still load the keys.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewJWKS(JWKSOptions{URL: srv.URL}).Key(ctx, RS256, "rs"); err != nil {
+		t.Errorf("Key() with a cancelled context error = %v", err)
+	}
+}
+
+func TestJWKSFile(t *testing.T) {
+	keys := newTestKeys(t)
+	set, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		ecJWK("es", &keys.ec.PublicKey),
+		{"kty": "oct", "kid": "hs", "k": base64.RawURLEncoding.EncodeToString(keys.secret)},
+	}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, set, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := NewJWKS(JWKSOptions{File: path})
+	if err := jwks.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	opts := JWTOptions{Keys: jwks}
+	claims := map[string]any{"exp": time.Now().Add(time.Hour).Unix()}
+	for _, token := range []string{
+		signJWT(t, ES256, "es", keys.ec, claims),
+		signJWT(t, HS256, "hs", keys.secret, claims),
+	} {
+		if _, err := VerifyJWT(context.Background(), token, opts); err != nil {
+			t.Errorf("VerifyJWT() error = %v", err)
+		}
+	}
+}
+
+func TestParseJWKSRejectsOffCurvePoint(t *testing.T) {
+	set := `{"keys":[{"kty":"EC","kid":"bad","crv":"P-256","x":"AQ","y":"AQ"}]}`
+	if _, err := ParseJWKS([]byte(set)); err == nil {
+		t.Error("ParseJWKS() accepted a point that is not on the curve")
+	}
+}
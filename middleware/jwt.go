@@ -0,0 +1,298 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported JWT signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+)
+
+// KeySource resolves the key that verifies a token signed with alg by the key with id kid.
+// Keys are []byte for HS256, *rsa.PublicKey for RS256 and *ecdsa.PublicKey for ES256.
+type KeySource interface {
+	Key(ctx context.Context, alg, kid string) (any, error)
+}
+
+// StaticKeys is a KeySource backed by a fixed set of keys by kid.
+// The empty kid is used for tokens without a kid header.
+type StaticKeys map[string]any
+
+func (s StaticKeys) Key(ctx context.Context, alg, kid string) (any, error) {
+	key, ok := s[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// Claims are the verified claims of a JWT.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+	Raw       map[string]any // Every claim in the payload, numbers are json.Number.
+}
+
+// JWTOptions configures token verification.
+type JWTOptions struct {
+	Keys       KeySource
+	Algorithms []string      // Accepted algorithms, defaults to HS256, RS256 and ES256.
+	Issuer     string        // Required iss claim, unchecked when empty.
+	Audience   []string      // The aud claim must contain at least one of these, unchecked when empty.
+	Leeway     time.Duration // Allowed clock skew when checking exp and nbf.
+	Realm      string        // Realm reported in WWW-Authenticate challenges by AuthMiddleware.
+
+	now func() time.Time
+}
+
+// Principal builds the principal of the token: sub is the ID, scopes come from the space separated
+// scope claim (RFC 8693) or the scp claim, and roles from the roles claim.
+func (c *Claims) Principal() *Principal {
+	p := &Principal{ID: c.Subject}
+	if scope, ok := c.Raw["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = stringList(c.Raw["scp"])
+	}
+	p.Roles = stringList(c.Raw["roles"])
+	return p
+}
+
+// stringList reads a claim that is either a space separated string or an array of strings.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var out []string
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// VerifyJWT checks the signature and registered claims of a compact serialized JWT.
+// The exp claim is required.
+func VerifyJWT(ctx context.Context, token string, opts JWTOptions) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrMalformedToken, err)
+	}
+	algs := opts.Algorithms
+	if len(algs) == 0 {
+		algs = []string{HS256, RS256, ES256}
+	}
+	if !slices.Contains(algs, header.Alg) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrMalformedToken, err)
+	}
+	if opts.Keys == nil {
+		return nil, ErrUnknownKey
+	}
+	key, err := opts.Keys.Key(ctx, header.Alg, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrMalformedToken, err)
+	}
+	claims, err := parseClaims(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if opts.now != nil {
+		now = opts.now()
+	}
+	if claims.ExpiresAt.IsZero() || !now.Before(claims.ExpiresAt.Add(opts.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Add(opts.Leeway).Before(claims.NotBefore) {
+		return nil, ErrTokenNotYetValid
+	}
+	if opts.Issuer != "" && claims.Issuer != opts.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if len(opts.Audience) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(opts.Audience, aud)
+	}) {
+		return nil, ErrInvalidAudience
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// verifySignature checks sig over signingInput, the key type must match alg so that
+// a public key can never be used as an HMAC secret.
+func verifySignature(alg string, key any, signingInput string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("%w: HS256 needs a []byte key, got %T", ErrUnknownKey, key)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: RS256 needs an *rsa.PublicKey, got %T", ErrUnknownKey, key)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return ErrInvalidSignature
+		}
+	case ES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: ES256 needs an *ecdsa.PublicKey, got %T", ErrUnknownKey, key)
+		}
+		// JWS encodes the signature as r || s, each 32 bytes, RFC 7518 section 3.4.
+		if len(sig) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlg, alg)
+	}
+	return nil
+}
+
+func parseClaims(raw map[string]any) (*Claims, error) {
+	c := &Claims{Raw: raw}
+
+	var err error
+	str := func(name string) string {
+		v, ok := raw[name]
+		if !ok || err != nil {
+			return ""
+		}
+		s, ok := v.(string)
+		if !ok {
+			err = fmt.Errorf("%w: %s must be a string", ErrMalformedToken, name)
+		}
+		return s
+	}
+	date := func(name string) time.Time {
+		v, ok := raw[name]
+		if !ok || err != nil {
+			return time.Time{}
+		}
+		n, ok := v.(json.Number)
+		if !ok {
+			err = fmt.Errorf("%w: %s must be a number", ErrMalformedToken, name)
+			return time.Time{}
+		}
+		f, ferr := n.Float64()
+		if ferr != nil {
+			err = fmt.Errorf("%w: %s: %v", ErrMalformedToken, name, ferr)
+			return time.Time{}
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9))
+	}
+
+	c.Issuer = str("iss")
+	c.Subject = str("sub")
+	c.ID = str("jti")
+	c.ExpiresAt = date("exp")
+	c.NotBefore = date("nbf")
+	c.IssuedAt = date("iat")
+	if err != nil {
+		return nil, err
+	}
+
+	switch aud := raw["aud"].(type) {
+	case nil:
+	case string:
+		c.Audience = []string{aud}
+	case []any:
+		for _, a := range aud {
+			s, ok := a.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: aud must contain strings", ErrMalformedToken)
+			}
+			c.Audience = append(c.Audience, s)
+		}
+	default:
+		return nil, fmt.Errorf("%w: aud must be a string or array", ErrMalformedToken)
+	}
+
+	return c, nil
+}
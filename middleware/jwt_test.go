@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signJWT builds a compact JWT, key is the HMAC secret or the private key matching alg.
+func signJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+type testKeys struct {
+	secret []byte
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{secret: []byte("hmac-secret"), rsa: rsaKey, ec: ecKey}
+}
+
+func (k testKeys) source() StaticKeys {
+	return StaticKeys{"hs": k.secret, "rs": &k.rsa.PublicKey, "es": &k.ec.PublicKey}
+}
+
+func TestVerifyJWT(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Unix(1_700_000_000, 0)
+	opts := JWTOptions{
+		Keys:     keys.source(),
+		Issuer:   "https://issuer.example",
+		Audience: []string{"api"},
+		Leeway:   30 * time.Second,
+		now:      func() time.Time { return now },
+	}
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss": "https://issuer.example",
+			"sub": "user-1",
+			"aud": []string{"other", "api"},
+			"exp": now.Add(time.Minute).Unix(),
+			"nbf": now.Add(-time.Minute).Unix(),
+		}
+	}
+	with := func(k string, v any) map[string]any {
+		c := valid()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"HS256", signJWT(t, HS256, "hs", keys.secret, valid()), nil},
+		{"RS256", signJWT(t, RS256, "rs", keys.rsa, valid()), nil},
+		{"ES256", signJWT(t, ES256, "es", keys.ec, valid()), nil},
+		{"string audience", signJWT(t, HS256, "hs", keys.secret, with("aud", "api")), nil},
+		{"expired within leeway", signJWT(t, HS256, "hs", keys.secret, with("exp", now.Add(-10*time.Second).Unix())), nil},
+		{"expired", signJWT(t, HS256, "hs", keys.secret, with("exp", now.Add(-time.Minute).Unix())), ErrTokenExpired},
+		{"missing exp", signJWT(t, HS256, "hs", keys.secret, with("exp", nil)), ErrTokenExpired},
+		{"not yet valid", signJWT(t, HS256, "hs", keys.secret, with("nbf", now.Add(time.Minute).Unix())), ErrTokenNotYetValid},
+		{"wrong issuer", signJWT(t, HS256, "hs", keys.secret, with("iss", "evil")), ErrInvalidIssuer},
+		{"wrong audience", signJWT(t, HS256, "hs", keys.secret, with("aud", "web")), ErrInvalidAudience},
+		{"wrong secret", signJWT(t, HS256, "hs", []byte("nope"), valid()), ErrInvalidSignature},
+		{"unknown kid", signJWT(t, HS256, "nope", keys.secret, valid()), ErrUnknownKey},
+		{"alg confusion", signJWT(t, HS256, "rs", keys.secret, valid()), ErrUnknownKey},
+		{"alg none", signJWT(t, "none", "hs", nil, valid()), ErrUnsupportedAlg},
+		{"malformed", "not.a-token", ErrMalformedToken},
+		{"bad exp type", signJWT(t, HS256, "hs", keys.secret, with("exp", "tomorrow")), ErrMalformedToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := VerifyJWT(context.Background(), tt.token, opts)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyJWT() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && claims.Subject != "user-1" {
+				t.Errorf("Subject = %q, want user-1", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	keys := newTestKeys(t)
+	opts := JWTOptions{Keys: keys.source(), Realm: "api"}
+	token := signJWT(t, HS256, "hs", keys.secret, map[string]any{"sub": "user-1", "exp": time.Now().Add(time.Minute).Unix()})
+
+	h := AuthMiddleware(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			t.Error("claims missing from context")
+			return
+		}
+		w.Write([]byte(claims.Subject))
+	}))
+
+	tests := []struct {
+		name      string
+		header    string
+		status    int
+		challenge string
+	}{
+		{"valid", "Bearer " + token, http.StatusOK, ""},
+		{"missing", "", http.StatusUnauthorized, `Bearer realm="api"`},
+		{"wrong scheme", "Basic dXNlcjpwYXNz", http.StatusBadRequest, `Bearer realm="api", error="invalid_request", error_description="expected a Bearer token"`},
+		{"invalid", "Bearer " + token + "x", http.StatusUnauthorized, `Bearer realm="api", error="invalid_token", error_description="invalid signature"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != "user-1" {
+				t.Errorf("body = %q, want user-1", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter decides whether the client identified by key may make another request.
+// Implementations must be safe for concurrent use.
+type Limiter interface {
+	Allow(key string) Decision
+}
+
+// Decision is the outcome of a single rate limit check.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // Requests allowed in a full quota.
+	Remaining  int           // Requests left right now.
+	Reset      time.Duration // Until the client is back to its full quota.
+	RetryAfter time.Duration // Until the next request would be allowed, only set when rejected.
+}
+
+// keyState is the per-key state of a limiter. Keys whose state is idle are dropped, at most once
+// per sweepEvery, so that the key map only holds clients seen recently.
+type keyState[S any] struct {
+	mu         sync.Mutex
+	now        func() time.Time
+	keys       map[string]*S
+	lastSweep  time.Time
+	sweepEvery time.Duration
+	idle       func(s *S, now time.Time) bool
+}
+
+func newKeyState[S any](sweepEvery time.Duration, idle func(*S, time.Time) bool) keyState[S] {
+	return keyState[S]{now: time.Now, keys: make(map[string]*S), sweepEvery: sweepEvery, idle: idle}
+}
+
+// checkLimit panics unless limit and period describe a usable rate, like the other constructors in this package.
+func checkLimit(name string, limit int, period time.Duration) {
+	if limit <= 0 || period <= 0 {
+		panic(fmt.Sprintf("middleware: %s needs a positive limit and period, got %d per %s", name, limit, period))
+	}
+}
+
+// get returns the state for key, creating it with init when missing. Caller must hold ks.mu.
+func (ks *keyState[S]) get(key string, now time.Time, init func() *S) *S {
+	if now.Sub(ks.lastSweep) >= ks.sweepEvery {
+		ks.lastSweep = now
+		for k, s := range ks.keys {
+			if ks.idle(s, now) {
+				delete(ks.keys, k)
+			}
+		}
+	}
+
+	s, ok := ks.keys[key]
+	if !ok {
+		s = init()
+		ks.keys[key] = s
+	}
+	return s
+}
+
+// TokenBucket allows bursts of up to burst requests, refilled steadily at limit per period.
+type TokenBucket struct {
+	rate  float64 // tokens per second.
+	burst float64
+	state keyState[bucket]
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a TokenBucket, burst defaults to limit when zero or negative.
+// It panics unless limit and period are positive.
+func NewTokenBucket(limit int, period time.Duration, burst int) *TokenBucket {
+	checkLimit("TokenBucket", limit, period)
+	if burst <= 0 {
+		burst = limit
+	}
+	tb := &TokenBucket{rate: float64(limit) / period.Seconds(), burst: float64(burst)}
+	// A bucket that has refilled completely behaves exactly like a missing one.
+	tb.state = newKeyState(tb.fill(tb.burst), func(b *bucket, now time.Time) bool {
+		return b.tokens+now.Sub(b.last).Seconds()*tb.rate >= tb.burst
+	})
+	return tb
+}
+
+func (tb *TokenBucket) Allow(key string) Decision {
+	tb.state.mu.Lock()
+	defer tb.state.mu.Unlock()
+
+	now := tb.state.now()
+	b := tb.state.get(key, now, func() *bucket { return &bucket{tokens: tb.burst, last: now} })
+	b.tokens = min(tb.burst, b.tokens+now.Sub(b.last).Seconds()*tb.rate)
+	b.last = now
+
+	d := Decision{Limit: int(tb.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = tb.fill(1 - b.tokens)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = tb.fill(tb.burst - b.tokens)
+	return d
+}
+
+// fill returns how long it takes to refill n tokens.
+func (tb *TokenBucket) fill(n float64) time.Duration {
+	if tb.rate <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(n / tb.rate * float64(time.Second)))
+}
+
+// SlidingLog allows limit requests in any window, eg. 1000 per rolling hour, exactly.
+// It keeps a timestamp per request, so memory grows with limit per client.
+type SlidingLog struct {
+	limit  int
+	window time.Duration
+	state  keyState[[]time.Time]
+}
+
+// NewSlidingLog creates a SlidingLog. It panics unless limit and window are positive.
+func NewSlidingLog(limit int, window time.Duration) *SlidingLog {
+	checkLimit("SlidingLog", limit, window)
+	return &SlidingLog{
+		limit:  limit,
+		window: window,
+		state: newKeyState(window, func(log *[]time.Time, now time.Time) bool {
+			return len(*log) == 0 || now.Sub((*log)[len(*log)-1]) >= window
+		}),
+	}
+}
+
+func (sl *SlidingLog) Allow(key string) Decision {
+	sl.state.mu.Lock()
+	defer sl.state.mu.Unlock()
+
+	now := sl.state.now()
+	log := sl.state.get(key, now, func() *[]time.Time { return new([]time.Time) })
+
+	// Drop the requests that left the window, the log is sorted oldest first.
+	i := 0
+	for i < len(*log) && now.Sub((*log)[i]) >= sl.window {
+		i++
+	}
+	*log = (*log)[i:]
+
+	d := Decision{Limit: sl.limit}
+	if len(*log) < sl.limit {
+		*log = append(*log, now)
+		d.Allowed = true
+	} else {
+		d.RetryAfter = (*log)[0].Add(sl.window).Sub(now)
+	}
+	d.Remaining = sl.limit - len(*log)
+	if len(*log) > 0 {
+		d.Reset = (*log)[len(*log)-1].Add(sl.window).Sub(now)
+	}
+	return d
+}
+
+// SlidingWindow approximates a rolling window with two fixed window counters, weighting the previous
+// window by how much of it still overlaps the rolling one. It uses constant memory per client.
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	state  keyState[windowCounter]
+}
+
+type windowCounter struct {
+	start      time.Time // start of the current fixed window.
+	curr, prev int
+}
+
+// NewSlidingWindow creates a SlidingWindow. It panics unless limit and window are positive.
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	checkLimit("SlidingWindow", limit, window)
+	return &SlidingWindow{
+		limit:  limit,
+		window: window,
+		state: newKeyState(window, func(c *windowCounter, now time.Time) bool {
+			return now.Sub(c.start) >= 2*window
+		}),
+	}
+}
+
+func (sw *SlidingWindow) Allow(key string) Decision {
+	sw.state.mu.Lock()
+	defer sw.state.mu.Unlock()
+
+	now := sw.state.now()
+	start := now.Truncate(sw.window)
+	c := sw.state.get(key, now, func() *windowCounter { return &windowCounter{start: start} })
+
+	switch elapsed := start.Sub(c.start); {
+	case elapsed >= 2*sw.window:
+		c.prev, c.curr = 0, 0
+	case elapsed >= sw.window:
+		c.prev, c.curr = c.curr, 0
+	}
+	c.start = start
+
+	w := sw.window.Seconds()
+	e := now.Sub(start).Seconds()
+	estimate := func() float64 { return float64(c.prev)*(1-e/w) + float64(c.curr) }
+
+	d := Decision{Limit: sw.limit}
+	if estimate()+1 <= float64(sw.limit) {
+		c.curr++
+		d.Allowed = true
+	} else {
+		d.RetryAfter = sw.retryAfter(c, e, w)
+	}
+	d.Remaining = max(0, int(math.Floor(float64(sw.limit)-estimate())))
+	// Everything counted so far has rolled off once the next window has passed too.
+	d.Reset = time.Duration((2*w - e) * float64(time.Second))
+	if c.curr == 0 {
+		d.Reset = time.Duration((w - e) * float64(time.Second))
+	}
+	return d
+}
+
+// retryAfter returns how long until the estimate drops enough to allow one more request.
+func (sw *SlidingWindow) retryAfter(c *windowCounter, e, w float64) time.Duration {
+	allowed := float64(sw.limit - 1)
+	var secs float64
+	if float64(c.curr) <= allowed && c.prev > 0 {
+		// Still in this window, wait for the previous window's weight to fade enough.
+		// Once the window ends the estimate is at most curr, which is allowed.
+		secs = min(w*(1-(allowed-float64(c.curr))/float64(c.prev))-e, w-e)
+	} else {
+		// Wait for the next window, where this window's count becomes the fading one.
+		secs = w - e
+		if c.curr > 0 {
+			secs += max(0, w*(1-allowed/float64(c.curr)))
+		}
+	}
+	return time.Duration(math.Ceil(max(0, secs) * float64(time.Second)))
+}
+
+// GCRA is the generic cell rate algorithm: it spaces requests limit per period apart while
+// tolerating bursts of up to burst, with a single timestamp of state per client.
+type GCRA struct {
+	interval time.Duration // emission interval, period / limit.
+	burst    int
+	state    keyState[time.Time] // theoretical arrival time per key.
+}
+
+// NewGCRA creates a GCRA, burst defaults to limit when zero or negative.
+// It panics unless limit and period are positive and period / limit is at least a nanosecond.
+func NewGCRA(limit int, period time.Duration, burst int) *GCRA {
+	checkLimit("GCRA", limit, period)
+	if burst <= 0 {
+		burst = limit
+	}
+	interval := period / time.Duration(limit)
+	if interval == 0 {
+		panic(fmt.Sprintf("middleware: GCRA limit %d is too high for a period of %s", limit, period))
+	}
+	return &GCRA{
+		interval: interval,
+		burst:    burst,
+		state: newKeyState(interval*time.Duration(burst), func(tat *time.Time, now time.Time) bool {
+			return !tat.After(now)
+		}),
+	}
+}
+
+func (g *GCRA) Allow(key string) Decision {
+	g.state.mu.Lock()
+	defer g.state.mu.Unlock()
+
+	now := g.state.now()
+	tat := g.state.get(key, now, func() *time.Time { t := now; return &t })
+	if tat.Before(now) {
+		*tat = now
+	}
+
+	tolerance := g.interval * time.Duration(g.burst)
+	newTAT := tat.Add(g.interval)
+	allowAt := newTAT.Add(-tolerance)
+
+	d := Decision{Limit: g.burst}
+	if now.Before(allowAt) {
+		d.RetryAfter = allowAt.Sub(now)
+		d.Reset = tat.Sub(now)
+		return d
+	}
+	*tat = newTAT
+	d.Allowed = true
+	d.Remaining = int(now.Sub(allowAt) / g.interval)
+	d.Reset = newTAT.Sub(now)
+	return d
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock returns a clock func and a function to move it forward.
+func fakeClock() (func() time.Time, func(time.Duration)) {
+	now := time.Unix(1_700_000_000, 0)
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLimiters(t *testing.T) {
+	tests := []struct {
+		name string
+		new  func(now func() time.Time) Limiter
+	}{
+		{"token bucket", func(now func() time.Time) Limiter {
+			l := NewTokenBucket(3, time.Second, 3)
+			l.state.now = now
+			return l
+		}},
+		{"sliding log", func(now func() time.Time) Limiter {
+			l := NewSlidingLog(3, time.Second)
+			l.state.now = now
+			return l
+		}},
+		{"sliding window", func(now func() time.Time) Limiter {
+			l := NewSlidingWindow(3, time.Second)
+			l.state.now = now
+			return l
+		}},
+		{"gcra", func(now func() time.Time) Limiter {
+			l := NewGCRA(3, time.Second, 3)
+			l.state.now = now
+			return l
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, advance := fakeClock()
+			l := tt.new(now)
+
+			for i := range 3 {
+				d := l.Allow("a")
+				if !d.Allowed || d.Limit != 3 || d.Remaining != 2-i {
+					t.Fatalf("request %d: %+v, want allowed with %d remaining", i, d, 2-i)
+				}
+			}
+
+			d := l.Allow("a")
+			if d.Allowed || d.RetryAfter <= 0 || d.RetryAfter > 2*time.Second {
+				t.Fatalf("4th request: %+v, want rejected with RetryAfter in (0, 2s]", d)
+			}
+			if other := l.Allow("b"); !other.Allowed {
+				t.Error("keys must be limited independently")
+			}
+
+			advance(d.RetryAfter)
+			if d := l.Allow("a"); !d.Allowed {
+				t.Errorf("request after RetryAfter: %+v, want allowed", d)
+			}
+
+			advance(3 * time.Second)
+			for i := range 3 {
+				if d := l.Allow("a"); !d.Allowed {
+					t.Errorf("request %d after idle period: %+v, want allowed", i, d)
+				}
+			}
+		})
+	}
+}
+
+func TestSlidingLogIsRolling(t *testing.T) {
+	now, advance := fakeClock()
+	l := NewSlidingLog(2, time.Hour)
+	l.state.now = now
+
+	l.Allow("a")
+	advance(50 * time.Minute)
+	l.Allow("a")
+	advance(20 * time.Minute) // the first request left the window, the second didn't.
+
+	if d := l.Allow("a"); !d.Allowed {
+		t.Fatalf("%+v, want allowed", d)
+	}
+	d := l.Allow("a")
+	if d.Allowed {
+		t.Fatal("3rd request within the rolling hour was allowed")
+	}
+	if d.RetryAfter != 40*time.Minute {
+		t.Errorf("RetryAfter = %v, want 40m, when the second request leaves the window", d.RetryAfter)
+	}
+}
+
+func TestRateLimitWithLimiter(t *testing.T) {
+	h := RateLimit(RateLimitOptions{Limiter: NewGCRA(1, time.Minute, 1)})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	codes := make([]int, 2)
+	for i := range codes {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes[i] = rec.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("status codes = %v, want [200 429]", codes)
+	}
+}
+
+func TestLimiterConstructorsRejectInvalidRates(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"token bucket zero limit", func() { NewTokenBucket(0, time.Second, 0) }},
+		{"token bucket zero period", func() { NewTokenBucket(1, 0, 0) }},
+		{"sliding log zero window", func() { NewSlidingLog(1, 0) }},
+		{"sliding window zero window", func() { NewSlidingWindow(1, 0) }},
+		{"sliding window negative limit", func() { NewSlidingWindow(-1, time.Second) }},
+		{"gcra zero limit", func() { NewGCRA(0, time.Second, 0) }},
+		{"gcra sub-nanosecond interval", func() { NewGCRA(10, time.Nanosecond, 0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected panic")
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-armory/metrics"
+)
+
+// httpMetrics are the instruments recorded by the middleware in this package.
+type httpMetrics struct {
+	requests *metrics.Counter
+	duration *metrics.Histogram
+	inFlight *metrics.Gauge
+	traces   *metrics.Counter
+}
+
+// newHTTPMetrics registers the middleware instruments on reg, reusing them if already registered.
+func newHTTPMetrics(reg *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: reg.Counter("http_requests_total", "HTTP requests served.", "method", "route", "code"),
+		duration: reg.Histogram("http_request_duration_seconds", "HTTP request latency.", nil, "method", "route"),
+		inFlight: reg.Gauge("http_requests_in_flight", "HTTP requests currently being served."),
+		traces:   reg.Counter("http_traces_written_total", "Flight recorder traces written for slow requests."),
+	}
+}
+
+// MetricsMiddleware records request count, latency and in-flight requests on reg.
+// The route label is the matched http.ServeMux pattern, so wrap handlers registered on the mux
+// (or place this after any middleware that replaces the request) to avoid one series per path.
+func MetricsMiddleware(reg *metrics.Registry) func(http.Handler) http.Handler {
+	m := newHTTPMetrics(reg)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			m.inFlight.Inc()
+			defer m.inFlight.Dec()
+
+			rw := NewResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			status := rw.Status()
+			if status == 0 { // handler returned without writing, net/http sends a 200.
+				status = http.StatusOK
+			}
+			m.requests.Inc(r.Method, r.Pattern, strconv.Itoa(status))
+			m.duration.Observe(time.Since(start).Seconds(), r.Method, r.Pattern)
+		})
+	}
+}
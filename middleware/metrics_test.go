@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-armory/metrics"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /items/{id}", MetricsMiddleware(reg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	})))
+
+	for _, path := range []string{"/items/1", "/items/2", "/items/missing"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	m := newHTTPMetrics(reg)
+	if got := m.requests.Value("GET", "GET /items/{id}", "200"); got != 2 {
+		t.Errorf("200 requests = %v, want 2", got)
+	}
+	if got := m.requests.Value("GET", "GET /items/{id}", "404"); got != 1 {
+		t.Errorf("404 requests = %v, want 1", got)
+	}
+	if got := m.inFlight.Value(); got != 0 {
+		t.Errorf("in flight = %v, want 0", got)
+	}
+}
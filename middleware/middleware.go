@@ -2,157 +2,381 @@ package middleware
 
 import (
 	"context"
-	//	"encoding/json"
+	"encoding/json"
 	"fmt"
-	//	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
-	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"runtime/trace"
 
 	"github.com/google/uuid"
+
+	"go-armory/metrics"
 )
 
-type config struct {
-	fr     *trace.FlightRecorder
-	wg     *sync.WaitGroup
-	logger *slog.Logger
+// Config holds what the middleware in this package share: the logger, the flight recorder
+// traces are taken from, and the requests in flight. Create it with New.
+type Config struct {
+	fr        *trace.FlightRecorder
+	wg        sync.WaitGroup // requests in flight, tracked by LoggingMiddleware.
+	logger    *slog.Logger
+	metrics   *httpMetrics  // optional, see WithMetrics.
+	accessLog *AccessLogger // optional, LoggingMiddleware logs through logger when nil.
+	trace     TraceOptions
+
+	traceMu   sync.Mutex // serializes trace writes, the flight recorder can't write two at once.
+	lastTrace time.Time  // when the last trace was written, for TraceOptions.Cooldown.
 }
-type contextKey string
 
-const (
-	requestIDKey contextKey = "request_id" // type save context keys.
-)
+// Option configures a Config.
+type Option func(*Config)
+
+// WithLogger sets the logger, defaults to JSON on stdout.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Config) {
+		c.logger = l
+	}
+}
 
-// Chain slice of middleware funcs to be applied using slice.Backward(middleware is applied starting from last to first element).
-type Chain []func(http.Handler) http.Handler
+// WithFlightRecorder has New create and start a flight recorder, which TraceMiddleware
+// and RecoverMiddleware take traces from. Without it no traces are written.
+func WithFlightRecorder(frcfg trace.FlightRecorderConfig) Option {
+	return func(c *Config) {
+		c.fr = trace.NewFlightRecorder(frcfg)
+	}
+}
 
-func (c Chain) thenFunc(h http.HandlerFunc) http.Handler {
-	return c.then(h)
+// WithAccessLog has LoggingMiddleware write access entries with an AccessLogger instead of the logger.
+func WithAccessLog(opts AccessLogOptions) Option {
+	return func(c *Config) {
+		c.accessLog = NewAccessLogger(opts)
+	}
+}
+
+// WithTraceOptions configures TraceMiddleware, see TraceOptions for the defaults.
+func WithTraceOptions(opts TraceOptions) Option {
+	return func(c *Config) {
+		c.trace = opts
+	}
 }
 
-func (c Chain) then(h http.Handler) http.Handler {
-	for _, mw := range slices.Backward(c) {
-		h = mw(h)
+// WithMetrics counts the traces written on reg. Request metrics are recorded by MetricsMiddleware.
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(c *Config) {
+		c.metrics = newHTTPMetrics(reg)
 	}
-	return h
 }
 
+// New creates a Config, starting its flight recorder if one is configured. Call Close to stop it.
+func New(options ...Option) (*Config, error) {
+	c := &Config{}
+	for _, opt := range options {
+		opt(c)
+	}
+	if c.logger == nil {
+		c.logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	}
+	if c.fr != nil {
+		if err := c.fr.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start flight recorder: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Logger returns the logger the middleware log to.
+func (cfg *Config) Logger() *slog.Logger {
+	return cfg.logger
+}
+
+// Wait blocks until the requests in flight have completed or ctx is done, whichever comes first.
+// Call it once the server stopped accepting requests, eg. after http.Server.Shutdown.
+func (cfg *Config) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		cfg.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the flight recorder.
+func (cfg *Config) Close() error {
+	if cfg.fr != nil && cfg.fr.Enabled() {
+		cfg.fr.Stop()
+	}
+	return nil
+}
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "request_id" // type save context keys.
+	claimsKey    contextKey = "claims"
+	principalKey contextKey = "principal"
+)
+
 func GenerateUUID() string {
 	return uuid.New().String()
 }
 
-// LoggingMiddleware initial middleware starts a log and assigns a request id.
-func (cfg *config) LoggingMiddleware(next http.Handler) http.Handler {
+// LoggingMiddleware initial middleware assigns a request id and logs an access entry
+// with the status, response size and duration once the handler completes.
+// The id is taken from a valid X-Request-ID or traceparent header when present, see RequestIDFromContext,
+// and echoed in the X-Request-ID response header.
+// Entries go to the config's access logger when set, and to its slog.Logger otherwise.
+// The request counts as in flight, see Config.Wait, until the entry is logged.
+func (cfg *Config) LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		reqID := GenerateUUID()
-		fmt.Println("Log mid")
+		cfg.wg.Add(1)
+		defer cfg.wg.Done()
+
+		start := time.Now()
+		reqID := requestID(r)
 
 		ctx := context.WithValue(r.Context(), requestIDKey, reqID)
 		r = r.WithContext(ctx)
+		w.Header().Set(RequestIDHeader, reqID)
+
+		rw := NewResponseWriter(w)
+		next.ServeHTTP(rw, r)
+
+		status := rw.Status()
+		if status == 0 { // handler returned without writing, net/http sends a 200.
+			status = http.StatusOK
+		}
+
+		if cfg.accessLog != nil {
+			user, _, _ := r.BasicAuth()
+			err := cfg.accessLog.Log(AccessLogEntry{
+				Time:       start,
+				RemoteAddr: KeyByIP(r),
+				User:       user,
+				Method:     r.Method,
+				URI:        r.RequestURI,
+				Proto:      r.Proto,
+				Status:     status,
+				Bytes:      rw.BytesWritten(),
+				Duration:   time.Since(start),
+				Referer:    r.Referer(),
+				UserAgent:  r.UserAgent(),
+				RequestID:  reqID,
+			})
+			if err != nil {
+				cfg.logger.Error("failed to write access log",
+					slog.String("request_id", reqID),
+					slog.String("error", err.Error()),
+				)
+			}
+			return
+		}
 
 		cfg.logger.Info("request",
 			slog.String("method", r.Method),
 			slog.String("path", r.URL.Path),
 			slog.String("remote_addr", r.RemoteAddr),
 			slog.String("request_id", reqID),
+			slog.Int("status", status),
+			slog.Int64("bytes", rw.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
 		)
-
-		next.ServeHTTP(w, r)
 	})
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// AuthMiddleware verifies the bearer token of each request as a JWT and puts its claims in the
+// request context, see ClaimsFromContext. The principal built from the sub, scope/scp and roles
+// claims is attached too, see PrincipalFromContext.
+// Failures are answered with 401 (400 for malformed headers) and an RFC 6750 WWW-Authenticate challenge.
+func AuthMiddleware(opts JWTOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				bearerChallenge(w, http.StatusUnauthorized, opts.Realm, "", "")
+				return
+			}
 
-		fmt.Println("Auth mid")
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			fmt.Println("unauth access")
-			w.WriteHeader(401)
-			return
-			// TODO: add actual logic duhh
-		}
-		next.ServeHTTP(w, r)
-	})
+			scheme, token, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				bearerChallenge(w, http.StatusBadRequest, opts.Realm, "invalid_request", "expected a Bearer token")
+				return
+			}
+
+			claims, err := VerifyJWT(r.Context(), strings.TrimSpace(token), opts)
+			if err != nil {
+				bearerChallenge(w, http.StatusUnauthorized, opts.Realm, "invalid_token", err.Error())
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsKey, claims)
+			ctx = context.WithValue(ctx, principalKey, claims.Principal())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
 
-// TraceMiddleware saves a trace file to traces dir for each req that exceeds threshold.
-func (cfg *config) TraceMiddleware(next http.Handler) http.Handler {
+// ClaimsFromContext returns the claims of the token verified by AuthMiddleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*Claims)
+	return claims, ok
+}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// bearerChallenge responds with status and a WWW-Authenticate Bearer challenge, RFC 6750 section 3.
+// code and desc are left out of the challenge when empty.
+func bearerChallenge(w http.ResponseWriter, status int, realm, code, desc string) {
+	params := []string{}
+	if realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", realm))
+	}
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code))
+	}
+	if desc != "" {
+		params = append(params, fmt.Sprintf("error_description=%q", desc))
+	}
+
+	challenge := "Bearer"
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(status), status)
+}
 
-		fmt.Println("Trace mid")
+// TraceMiddleware saves a flight recorder trace for each request slower than the configured threshold,
+// see TraceOptions. Traces are named trace-<request_id>-<random>.out, see TraceInfo.ID.
+// Without a flight recorder, see WithFlightRecorder, next is returned as is.
+func (cfg *Config) TraceMiddleware(next http.Handler) http.Handler {
+	if cfg.fr == nil {
+		return next
+	}
+	opts := cfg.trace.withDefaults()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
 		next.ServeHTTP(w, r)
 
 		diff := time.Since(start)
-		threshold := 300 * time.Millisecond // trace will be written if time exceeds threshold.
-
-		if diff > threshold {
-
-			reqID, ok := r.Context().Value(requestIDKey).(string)
-			if !ok {
-				reqID = GenerateUUID() // fallback if not in context.
-			}
+		// r.Pattern is set by the ServeMux while routing, so it's only known once next returns.
+		if diff <= opts.threshold(r.Pattern) {
+			return
+		}
 
-			if err := writeTrace(cfg.fr, reqID); err != nil {
-				cfg.logger.Error("failed to write trace",
-					slog.String("request_id", reqID),
-					slog.String("error", err.Error()),
-				)
-				return
-			}
+		reqID, ok := RequestIDFromContext(r.Context())
+		if !ok {
+			reqID = GenerateUUID() // fallback if not in context.
+		}
 
-			cfg.logger.Warn("trace written",
+		info := TraceInfo{
+			RequestID: reqID,
+			Reason:    "slow",
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Pattern:   r.Pattern,
+			Duration:  diff,
+			Timestamp: start,
+		}
+		written, err := cfg.saveTrace(info)
+		if err != nil {
+			cfg.logger.Error("failed to write trace",
+				slog.String("request_id", reqID),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		if !written {
+			cfg.logger.Debug("trace skipped, cooling down",
 				slog.String("request_id", reqID),
-				slog.String("req_addr", r.RemoteAddr),
 				slog.Duration("duration", diff),
 			)
+			return
 		}
+
+		cfg.logger.Warn("trace written",
+			slog.String("request_id", reqID),
+			slog.String("req_addr", r.RemoteAddr),
+			slog.Duration("duration", diff),
+		)
 	})
 }
-func CrossOriginProtectMiddleware(next http.Handler) http.Handler {
-	cop := http.NewCrossOriginProtection()
 
-	cop.AddTrustedOrigin("https://foo.example.com")
+// saveTrace writes a trace for info unless one was written within TraceOptions.Cooldown, in which
+// case written is false. Every trace goes through it, so the cooldown holds across routes and callers.
+func (cfg *Config) saveTrace(info TraceInfo) (written bool, err error) {
+	opts := cfg.trace.withDefaults()
 
-	cop.SetDenyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("CSRF check failed"))
-	}))
+	cfg.traceMu.Lock()
+	defer cfg.traceMu.Unlock()
 
-	return cop.Handler(next)
+	if opts.Cooldown > 0 && time.Since(cfg.lastTrace) < opts.Cooldown {
+		return false, nil
+	}
+	if err := writeTrace(cfg.fr, opts, info); err != nil {
+		return false, err
+	}
+	cfg.lastTrace = time.Now()
+	if cfg.metrics != nil {
+		cfg.metrics.traces.Inc()
+	}
+	return true, nil
 }
 
-func writeTrace(fr *trace.FlightRecorder, reqID string) error {
-	if !fr.Enabled() {
+// writeTrace writes the flight recorder's trace to opts.Dir along with info in a sidecar JSON file,
+// then prunes the directory down to opts.MaxFiles and opts.MaxBytes. info.ID is assigned here.
+func writeTrace(fr *trace.FlightRecorder, opts TraceOptions, info TraceInfo) error {
+	if fr == nil || !fr.Enabled() {
 		return fmt.Errorf("flight recorder not enabled")
 	}
 
-	tracesDir := "traces"
-	if err := os.MkdirAll(tracesDir, 0755); err != nil {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
 		return fmt.Errorf("failed to create traces directory: %w", err)
 	}
 
-	filename := filepath.Join(tracesDir, fmt.Sprintf("trace-%s.out", reqID))
+	info.ID = newTraceID(info.RequestID)
+	filename := filepath.Join(opts.Dir, traceFileName(info.ID))
 	file, err := os.Create(filename)
 	if err != nil {
 		return fmt.Errorf("failed to create trace file: %w", err)
 	}
-
-	defer file.Close()
+	complete := false
+	defer func() {
+		if !complete { // a trace without its sidecar would still be listed.
+			removeTrace(filename)
+		}
+	}()
 
 	_, err = fr.WriteTo(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
 		return fmt.Errorf("failed to write trace data: %w", err)
 	}
 
+	meta, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to encode trace info: %w", err)
+	}
+	if err := os.WriteFile(sidecarName(filename), meta, 0644); err != nil {
+		return fmt.Errorf("failed to write trace info: %w", err)
+	}
+	complete = true
+
+	if err := pruneTraces(opts.Dir, opts.MaxFiles, opts.MaxBytes); err != nil {
+		return fmt.Errorf("failed to prune traces: %w", err)
+	}
+
 	return nil
 }
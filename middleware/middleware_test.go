@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"runtime/trace"
+	"strings"
+	"testing"
+	"time"
+
+	"go-armory/metrics"
+)
+
+func TestNew(t *testing.T) {
+	cfg, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Logger() == nil {
+		t.Error("New() has no default logger")
+	}
+	if cfg.fr != nil {
+		t.Error("New() created a flight recorder without WithFlightRecorder")
+	}
+	if err := cfg.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	var logs, access bytes.Buffer
+	reg := metrics.NewRegistry()
+	cfg, err := New(
+		WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))),
+		WithFlightRecorder(trace.FlightRecorderConfig{}),
+		WithAccessLog(AccessLogOptions{Format: FormatCommon, Output: &access}),
+		WithTraceOptions(TraceOptions{Threshold: time.Hour}),
+		WithMetrics(reg),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.fr.Enabled() {
+		t.Error("flight recorder not started")
+	}
+	if cfg.trace.Threshold != time.Hour {
+		t.Errorf("trace threshold = %v, want 1h", cfg.trace.Threshold)
+	}
+
+	h := cfg.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(access.String(), `"GET / HTTP/1.1" 200`) {
+		t.Errorf("access log = %q", access.String())
+	}
+
+	var out strings.Builder
+	reg.WriteTo(&out)
+	if !strings.Contains(out.String(), "http_traces_written_total") {
+		t.Error("WithMetrics didn't register the trace counter")
+	}
+
+	cfg.Close()
+	if cfg.fr.Enabled() {
+		t.Error("Close() didn't stop the flight recorder")
+	}
+}
+
+func TestConfigWait(t *testing.T) {
+	cfg, err := New(WithLogger(slog.New(slog.DiscardHandler)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	h := cfg.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := cfg.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() with a request in flight = %v, want context.DeadlineExceeded", err)
+	}
+
+	close(release)
+	if err := cfg.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() = %v, want nil once the request completed", err)
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitOptions configures RateLimit.
+type RateLimitOptions struct {
+	// Limiter decides which requests are allowed. Defaults to a token bucket built from
+	// Limit, Period and Burst, which are ignored when Limiter is set.
+	Limiter Limiter
+
+	Limit  int           // Requests allowed per Period, required unless Limiter is set.
+	Period time.Duration // Defaults to one second.
+	Burst  int           // Bucket size, how many requests may arrive at once. Defaults to Limit.
+
+	// KeyFunc partitions clients, each key gets its own allowance. Defaults to KeyByIP.
+	KeyFunc func(*http.Request) string
+	// OnLimited responds to rejected requests, after the rate limit headers are set.
+	// Defaults to a plain 429.
+	OnLimited http.Handler
+}
+
+// KeyByIP keys requests by the remote IP address. Behind a proxy, RemoteAddr is the proxy,
+// use a KeyFunc that reads the forwarded address your proxy sets instead.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader keys requests by the SHA-256 of header's value, eg. X-API-Key, falling back to KeyByIP when it's missing.
+// The value is whatever the client sent, so a client can dodge its limit by sending a new one with every request.
+// RateLimit must run after the middleware authenticating the header, which should reject unknown values,
+// prefer KeyByPrincipal there.
+func KeyByHeader(header string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(header); v != "" {
+			return header + ":" + HashAPIKey(v) // don't keep secrets around as map keys.
+		}
+		return KeyByIP(r)
+	}
+}
+
+// KeyByPrincipal keys requests by the principal attached by the auth middleware, falling back to KeyByIP.
+func KeyByPrincipal(r *http.Request) string {
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		return "principal:" + p.ID
+	}
+	return KeyByIP(r)
+}
+
+// RateLimit limits each client with opts.Limiter, by default to opts.Limit requests per opts.Period
+// using a token bucket. Every response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// rejected requests get a 429 with Retry-After.
+func RateLimit(opts RateLimitOptions) func(http.Handler) http.Handler {
+	if opts.Limiter == nil {
+		if opts.Period <= 0 {
+			opts.Period = time.Second
+		}
+		opts.Limiter = NewTokenBucket(opts.Limit, opts.Period, opts.Burst)
+	}
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = KeyByIP
+	}
+	if opts.OnLimited == nil {
+		opts.OnLimited = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := opts.Limiter.Allow(opts.KeyFunc(r))
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+			if !d.Allowed {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+				opts.OnLimited.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tb := NewTokenBucket(2, time.Second, 2)
+	now := time.Unix(0, 0)
+	tb.state.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance   time.Duration
+		key       string
+		allowed   bool
+		remaining int
+	}{
+		{0, "a", true, 1},
+		{0, "a", true, 0},
+		{0, "a", false, 0},
+		{0, "b", true, 1},
+		{500 * time.Millisecond, "a", true, 0},
+		{250 * time.Millisecond, "a", false, 0},
+		{2 * time.Second, "a", true, 1},
+	}
+
+	for i, s := range steps {
+		now = now.Add(s.advance)
+		d := tb.Allow(s.key)
+		if d.Allowed != s.allowed || d.Remaining != s.remaining {
+			t.Errorf("step %d: allow(%s) = %+v, want allowed=%v remaining=%d", i, s.key, d, s.allowed, s.remaining)
+		}
+	}
+}
+
+func TestTokenBucketSweep(t *testing.T) {
+	tb := NewTokenBucket(10, time.Second, 10)
+	now := time.Unix(0, 0)
+	tb.state.now = func() time.Time { return now }
+
+	for _, key := range []string{"a", "b", "c"} {
+		tb.Allow(key)
+	}
+	now = now.Add(2 * time.Second)
+	tb.Allow("d")
+
+	if n := len(tb.state.keys); n != 1 {
+		t.Errorf("buckets = %d, want 1 after idle buckets were swept", n)
+	}
+}
+
+func TestKeyByHeaderHashesValue(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	if key := KeyByHeader("X-API-Key")(req); strings.Contains(key, "secret-key") {
+		t.Errorf("key = %q, must not contain the raw header value", key)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	h := RateLimit(RateLimitOptions{Limit: 1, Period: time.Minute, KeyFunc: KeyByHeader("X-API-Key")})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do("k1")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first status = %d, want 200", first.Code)
+	}
+	for header, want := range map[string]string{"RateLimit-Limit": "1", "RateLimit-Remaining": "0", "RateLimit-Reset": "60"} {
+		if got := first.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	second := do("k1")
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("second status = %d, want 429", second.Code)
+	}
+	if got := second.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+
+	if other := do("k2"); other.Code != http.StatusOK {
+		t.Errorf("other key status = %d, want 200", other.Code)
+	}
+}
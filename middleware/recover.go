@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// RecoverMiddleware turns a panic in the handler chain into a 500 instead of a dropped connection.
+// The panic value and stack are logged with the request_id, and when the config has a running
+// flight recorder a trace is written the same way TraceMiddleware does.
+// If the handler already sent headers the response can't be changed, so it is left as is.
+// http.ErrAbortHandler is re-panicked so net/http can abort the response as intended.
+func (cfg *Config) RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := NewResponseWriter(w)
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			stack := debug.Stack()
+			if p, ok := v.(*handlerPanic); ok { // re-raised by Timeout.
+				v, stack = p.value, p.stack
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			reqID, ok := RequestIDFromContext(r.Context())
+			if !ok {
+				reqID = GenerateUUID()
+			}
+
+			cfg.logger.Error("panic recovered",
+				slog.String("request_id", reqID),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("panic", fmt.Sprint(v)),
+				slog.String("stack", string(stack)),
+			)
+
+			if cfg.fr != nil && cfg.fr.Enabled() {
+				if _, err := cfg.saveTrace(TraceInfo{
+					RequestID: reqID,
+					Reason:    "panic",
+					Method:    r.Method,
+					Path:      r.URL.Path,
+					Pattern:   r.Pattern,
+					Duration:  time.Since(start),
+					Timestamp: start,
+				}); err != nil {
+					cfg.logger.Error("failed to write trace",
+						slog.String("request_id", reqID),
+						slog.String("error", err.Error()),
+					)
+				}
+			}
+
+			if !rw.WroteHeader() {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
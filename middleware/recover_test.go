@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		status   int
+		body     string
+		panicked bool
+	}{
+		{"no panic", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }, http.StatusOK, "ok", false},
+		{"panic before write", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, http.StatusInternalServerError, "Internal Server Error\n", true},
+		{"panic after headers", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic(errors.New("boom"))
+		}, http.StatusAccepted, "", true},
+		{"panic after body", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("partial"))
+			panic("boom")
+		}, http.StatusOK, "partial", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			cfg := &Config{logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+			req := httptest.NewRequest(http.MethodGet, "/x", nil)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey, "req-1"))
+			rec := httptest.NewRecorder()
+			cfg.RecoverMiddleware(tt.handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.body)
+			}
+
+			logged := logs.String()
+			if !tt.panicked {
+				if logged != "" {
+					t.Errorf("unexpected log: %s", logged)
+				}
+				return
+			}
+			for _, want := range []string{`"request_id":"req-1"`, `"panic":"boom"`, "recover_test.go"} {
+				if !strings.Contains(logged, want) {
+					t.Errorf("log missing %s: %s", want, logged)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverMiddlewareRepanicsAbort(t *testing.T) {
+	cfg := &Config{logger: slog.New(slog.DiscardHandler)}
+	h := cfg.RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// RequestIDHeader carries the request id, read from requests and echoed on responses by LoggingMiddleware.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds inbound request ids, they end up in logs and trace file names.
+const maxRequestIDLen = 128
+
+// RequestIDFromContext returns the request id assigned by LoggingMiddleware.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok
+}
+
+// requestID picks the id of r: a valid X-Request-ID, else the trace id of a valid W3C traceparent,
+// else a new UUID.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	if id, ok := traceID(r.Header.Get("traceparent")); ok {
+		return id
+	}
+	return GenerateUUID()
+}
+
+// validRequestID accepts up to maxRequestIDLen letters, digits, '-', '_' and '.',
+// which keeps ids safe to log and to use in file names.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// traceID returns the trace-id of a traceparent header, https://www.w3.org/TR/trace-context/#traceparent-header.
+// Version 00 must have exactly four fields, later versions may append more.
+func traceID(traceparent string) (string, bool) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 {
+		return "", false
+	}
+	version, trace, parent, flags := parts[0], parts[1], parts[2], parts[3]
+	if !lowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", false
+	}
+	if !lowerHex(trace, 32) || !lowerHex(parent, 16) || !lowerHex(flags, 2) {
+		return "", false
+	}
+	if strings.Trim(trace, "0") == "" || strings.Trim(parent, "0") == "" {
+		return "", false
+	}
+	return trace, true
+}
+
+func lowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLoggingMiddlewareRequestID(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   string // empty means a generated UUID.
+	}{
+		{"generated", nil, ""},
+		{"x-request-id", map[string]string{"X-Request-ID": "abc-123_x.y"}, "abc-123_x.y"},
+		{"x-request-id wins over traceparent", map[string]string{"X-Request-ID": "abc", "traceparent": traceparent}, "abc"},
+		{"traceparent", map[string]string{"traceparent": traceparent}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"invalid x-request-id falls back to traceparent", map[string]string{"X-Request-ID": "../../etc/passwd", "traceparent": traceparent}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"x-request-id too long", map[string]string{"X-Request-ID": strings.Repeat("a", 129)}, ""},
+		{"x-request-id with spaces", map[string]string{"X-Request-ID": "a b"}, ""},
+		{"traceparent uppercase", map[string]string{"traceparent": strings.ToUpper(traceparent)}, ""},
+		{"traceparent zero trace id", map[string]string{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, ""},
+		{"traceparent zero parent id", map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"}, ""},
+		{"traceparent version ff", map[string]string{"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, ""},
+		{"traceparent v00 extra field", map[string]string{"traceparent": traceparent + "-extra"}, ""},
+		{"traceparent future version extra field", map[string]string{"traceparent": "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"traceparent short", map[string]string{"traceparent": "00-4bf92f35-00f067aa0ba902b7-01"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+			var seen string
+			h := cfg.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen, _ = RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if tt.want != "" && seen != tt.want {
+				t.Errorf("request id = %q, want %q", seen, tt.want)
+			}
+			if tt.want == "" {
+				if _, err := uuid.Parse(seen); err != nil {
+					t.Errorf("request id = %q, want a generated UUID", seen)
+				}
+			}
+			if got := rec.Header().Get(RequestIDHeader); got != seen {
+				t.Errorf("%s response header = %q, want %q", RequestIDHeader, got, seen)
+			}
+		})
+	}
+}
+
+func TestRequestIDFromContextMissing(t *testing.T) {
+	if id, ok := RequestIDFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); ok {
+		t.Errorf("RequestIDFromContext() = %q, true outside LoggingMiddleware", id)
+	}
+}
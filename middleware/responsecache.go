@@ -0,0 +1,346 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-armory/cache"
+)
+
+// CachedResponse is a response stored by ResponseCache.
+// A response that varies on request headers is stored twice: once under the primary key with only
+// Vary set, pointing lookups at the variant stored under the primary key plus the varied header values.
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Vary    []string  // Canonical header names the response varies on.
+	Stored  time.Time // When the response was stored.
+	Expires time.Time // When the response stops being fresh.
+	Age     int       // Age reported by the upstream response when it was stored, in seconds.
+}
+
+// ResponseCacheOptions configures a ResponseCache.
+type ResponseCacheOptions struct {
+	// Cache stores the responses, use cache.WithCapacity to bound it. Defaults to an unbounded cache.
+	Cache *cache.Cache[string, *CachedResponse]
+	// DefaultTTL is the freshness lifetime of cacheable responses that carry neither Cache-Control
+	// max-age nor Expires. Zero means such responses are not stored.
+	DefaultTTL time.Duration
+	// MaxBodySize is the largest body that will be stored, in bytes. Defaults to 1MB.
+	MaxBodySize int
+	// KeyFunc derives the cache key of a request. Defaults to host + request URI.
+	KeyFunc func(*http.Request) string
+}
+
+// ResponseCache is a shared HTTP cache for GET and HEAD responses.
+// It honours Cache-Control (no-store, no-cache, private, max-age, s-maxage), Expires and Vary,
+// and sets Age and X-Cache on responses.
+// Responses to authenticated requests, with an Authorization header or a principal, see PrincipalFromContext,
+// are only stored when marked public or s-maxage. Put Middleware after the auth middleware so it sees the principal.
+// Only the headers next sets are stored, those set by middleware in front of it are left to that middleware.
+type ResponseCache struct {
+	opts ResponseCacheOptions
+	now  func() time.Time
+}
+
+// NewResponseCache creates a ResponseCache, see ResponseCacheOptions for the defaults.
+func NewResponseCache(opts ResponseCacheOptions) *ResponseCache {
+	if opts.Cache == nil {
+		opts.Cache = cache.New[string, *CachedResponse]()
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.KeyFunc == nil {
+		opts.KeyFunc = func(r *http.Request) string {
+			return r.Host + r.URL.RequestURI()
+		}
+	}
+	return &ResponseCache{opts: opts, now: time.Now}
+}
+
+// Purge drops every stored variant of the response for r and returns how many entries were removed.
+func (rc *ResponseCache) Purge(r *http.Request) int {
+	return rc.opts.Cache.RemoveTag(rc.opts.KeyFunc(r))
+}
+
+// PurgePrefix drops every stored response whose key starts with prefix.
+func (rc *ResponseCache) PurgePrefix(prefix string) int {
+	return rc.opts.Cache.RemoveFunc(func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// Middleware serves fresh stored responses and stores cacheable responses of next.
+func (rc *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reqCC := parseCacheControl(r.Header.Values("Cache-Control"))
+		if reqCC.has("no-store") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := rc.opts.KeyFunc(r)
+		if !reqCC.has("no-cache") && reqCC["max-age"] != "0" {
+			if resp, ok := rc.lookup(key, r); ok {
+				rc.serve(w, r, resp)
+				return
+			}
+		}
+
+		// HEAD responses have no body to store, they are only served from stored GETs.
+		if r.Method == http.MethodHead {
+			w.Header().Set("X-Cache", "MISS")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		cw := &captureWriter{ResponseWriter: w, max: rc.opts.MaxBodySize, before: w.Header().Clone()}
+		next.ServeHTTP(cw, r)
+		rc.store(key, r, cw)
+	})
+}
+
+// lookup returns the fresh response stored for key, following Vary to the matching variant.
+func (rc *ResponseCache) lookup(key string, r *http.Request) (*CachedResponse, bool) {
+	resp, ok := rc.opts.Cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if resp.Body == nil && len(resp.Vary) > 0 {
+		resp, ok = rc.opts.Cache.Get(variantKey(key, resp.Vary, r))
+		if !ok {
+			return nil, false
+		}
+	}
+	if !rc.now().Before(resp.Expires) {
+		rc.opts.Cache.RemoveTag(key)
+		return nil, false
+	}
+	return resp, true
+}
+
+func (rc *ResponseCache) serve(w http.ResponseWriter, r *http.Request, resp *CachedResponse) {
+	h := w.Header()
+	for k, v := range resp.Header {
+		if _, ok := h[k]; !ok { // eg. X-Request-ID, set for this request by an outer middleware.
+			h[k] = slices.Clone(v)
+		}
+	}
+	age := resp.Age + int(rc.now().Sub(resp.Stored)/time.Second)
+	h.Set("Age", strconv.Itoa(age))
+	h.Set("X-Cache", "HIT")
+
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		w.Write(resp.Body)
+	}
+}
+
+// store saves the captured response if it is cacheable.
+func (rc *ResponseCache) store(key string, r *http.Request, cw *captureWriter) {
+	if cw.status == 0 { // handler returned without writing anything.
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.overflow || !cacheableStatus[cw.status] {
+		return
+	}
+
+	header := cw.header.Clone()
+	header.Del("X-Cache")
+	if header.Get("Set-Cookie") != "" {
+		return
+	}
+
+	cc := parseCacheControl(header.Values("Cache-Control"))
+	if cc.has("no-store") || cc.has("private") || cc.has("no-cache") {
+		return
+	}
+	// Responses to authenticated requests may only be shared when explicitly allowed, RFC 9111 section 3.5.
+	// API keys don't come in Authorization, the principal tells those requests apart.
+	_, authenticated := PrincipalFromContext(r.Context())
+	if (authenticated || r.Header.Get("Authorization") != "") && !cc.has("public") && !cc.has("s-maxage") {
+		return
+	}
+
+	vary := parseVary(header.Values("Vary"))
+	if slices.Contains(vary, "*") {
+		return
+	}
+
+	now := rc.now()
+	ttl, ok := rc.freshness(cc, header, now)
+	if !ok || ttl <= 0 {
+		return
+	}
+	age, _ := strconv.Atoi(header.Get("Age"))
+	header.Del("Age")
+
+	resp := &CachedResponse{
+		Status:  cw.status,
+		Header:  header,
+		Body:    bytes.Clone(cw.body.Bytes()),
+		Stored:  now,
+		Expires: now.Add(ttl - time.Duration(age)*time.Second),
+		Age:     age,
+	}
+	if resp.Body == nil {
+		resp.Body = []byte{}
+	}
+
+	// Every entry is tagged with the primary key so Purge drops all variants at once.
+	if len(vary) == 0 {
+		rc.opts.Cache.SetWithTags(key, resp, key)
+		return
+	}
+	rc.opts.Cache.SetWithTags(key, &CachedResponse{Vary: vary, Stored: now, Expires: resp.Expires}, key)
+	rc.opts.Cache.SetWithTags(variantKey(key, vary, r), resp, key)
+}
+
+// freshness returns how long a response stays fresh, s-maxage and max-age take precedence over Expires.
+func (rc *ResponseCache) freshness(cc cacheControl, header http.Header, now time.Time) (time.Duration, bool) {
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[directive]; ok {
+			secs, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, false
+			}
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	if v := header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0, false // invalid Expires means already expired, RFC 9111 section 5.3.
+		}
+		date := now
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		return expires.Sub(date), true
+	}
+	if rc.opts.DefaultTTL > 0 {
+		return rc.opts.DefaultTTL, true
+	}
+	return 0, false
+}
+
+// cacheableStatus are the status codes that are cacheable by default, RFC 9110 section 15.1.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// cacheControl maps lower-cased Cache-Control directives to their (unquoted) argument.
+type cacheControl map[string]string
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func parseCacheControl(values []string) cacheControl {
+	cc := cacheControl{}
+	for _, v := range values {
+		for part := range strings.SplitSeq(v, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return cc
+}
+
+func parseVary(values []string) []string {
+	var names []string
+	for _, v := range values {
+		for name := range strings.SplitSeq(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func variantKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteByte(0)
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// captureWriter passes the response through while keeping a copy of it, up to max bytes of body.
+// Only the headers changed since before, the headers when next was called, are kept.
+type captureWriter struct {
+	http.ResponseWriter
+	max      int
+	before   http.Header
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+		c.header = http.Header{}
+		for k, v := range c.ResponseWriter.Header() {
+			old := c.before[k]
+			switch {
+			case slices.Equal(old, v):
+			case len(v) > len(old) && slices.Equal(old, v[:len(old)]):
+				c.header[k] = slices.Clone(v[len(old):]) // added to, eg. Vary.
+			default:
+				c.header[k] = slices.Clone(v)
+			}
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.overflow {
+		if c.body.Len()+len(b) > c.max {
+			c.overflow = true
+			c.body = bytes.Buffer{}
+		} else {
+			c.body.Write(b)
+		}
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
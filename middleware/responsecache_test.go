@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingHandler responds with the number of times it was called, using header to set response headers.
+func countingHandler(calls *int, header http.Header) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		fmt.Fprintf(w, "call %d lang=%s", *calls, r.Header.Get("Accept-Language"))
+	})
+}
+
+func doRequest(h http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResponseCacheStorage(t *testing.T) {
+	tests := []struct {
+		name       string
+		respHeader http.Header
+		reqHeader  http.Header
+		defaultTTL time.Duration
+		wantCalls  int
+	}{
+		{"max-age", http.Header{"Cache-Control": {"max-age=60"}}, nil, 0, 1},
+		{"s-maxage", http.Header{"Cache-Control": {"s-maxage=60"}}, nil, 0, 1},
+		{"expires", http.Header{"Expires": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}, nil, 0, 1},
+		{"past expires", http.Header{"Expires": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}}, nil, 0, 2},
+		{"default ttl", nil, nil, time.Minute, 1},
+		{"no freshness", nil, nil, 0, 2},
+		{"no-store", http.Header{"Cache-Control": {"no-store, max-age=60"}}, nil, 0, 2},
+		{"private", http.Header{"Cache-Control": {"private, max-age=60"}}, nil, 0, 2},
+		{"set-cookie", http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}}, nil, 0, 2},
+		{"vary star", http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, nil, 0, 2},
+		{"request no-store", http.Header{"Cache-Control": {"max-age=60"}}, http.Header{"Cache-Control": {"no-store"}}, 0, 2},
+		{"request no-cache", http.Header{"Cache-Control": {"max-age=60"}}, http.Header{"Cache-Control": {"no-cache"}}, 0, 2},
+		{"authorization", http.Header{"Cache-Control": {"max-age=60"}}, http.Header{"Authorization": {"Bearer x"}}, 0, 2},
+		{"authorization public", http.Header{"Cache-Control": {"public, max-age=60"}}, http.Header{"Authorization": {"Bearer x"}}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			rc := NewResponseCache(ResponseCacheOptions{DefaultTTL: tt.defaultTTL})
+			h := rc.Middleware(countingHandler(&calls, tt.respHeader))
+
+			doRequest(h, http.MethodGet, "/x", tt.reqHeader)
+			rec := doRequest(h, http.MethodGet, "/x", tt.reqHeader)
+
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %d, want %d", calls, tt.wantCalls)
+			}
+			wantCache := "MISS"
+			if tt.wantCalls == 1 {
+				wantCache = "HIT"
+			}
+			if got := rec.Header().Get("X-Cache"); got != wantCache && tt.reqHeader.Get("Cache-Control") != "no-store" {
+				t.Errorf("X-Cache = %q, want %q", got, wantCache)
+			}
+		})
+	}
+}
+
+func TestResponseCacheHit(t *testing.T) {
+	var calls int
+	rc := NewResponseCache(ResponseCacheOptions{})
+	now := time.Now()
+	rc.now = func() time.Time { return now }
+	h := rc.Middleware(countingHandler(&calls, http.Header{"Cache-Control": {"max-age=60"}, "Content-Type": {"text/plain"}}))
+
+	first := doRequest(h, http.MethodGet, "/x", nil)
+	now = now.Add(5 * time.Second)
+	second := doRequest(h, http.MethodGet, "/x", nil)
+	head := doRequest(h, http.MethodHead, "/x", nil)
+
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("cached body = %q, want %q", second.Body.String(), first.Body.String())
+	}
+	if got := second.Header().Get("Age"); got != "5" {
+		t.Errorf("Age = %q, want 5", got)
+	}
+	if got := second.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+	if head.Body.Len() != 0 || head.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("HEAD should be served from the stored GET without a body, got %q %q", head.Header().Get("X-Cache"), head.Body.String())
+	}
+
+	now = now.Add(time.Minute)
+	doRequest(h, http.MethodGet, "/x", nil)
+	if calls != 2 {
+		t.Errorf("handler calls = %d, want 2 after the entry went stale", calls)
+	}
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	var calls int
+	rc := NewResponseCache(ResponseCacheOptions{})
+	h := rc.Middleware(countingHandler(&calls, http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"accept-language"}}))
+
+	en := http.Header{"Accept-Language": {"en"}}
+	de := http.Header{"Accept-Language": {"de"}}
+
+	doRequest(h, http.MethodGet, "/x", en)
+	doRequest(h, http.MethodGet, "/x", de)
+	gotEn := doRequest(h, http.MethodGet, "/x", en)
+	gotDe := doRequest(h, http.MethodGet, "/x", de)
+
+	if calls != 2 {
+		t.Errorf("handler calls = %d, want 2", calls)
+	}
+	if gotEn.Body.String() != "call 1 lang=en" || gotDe.Body.String() != "call 2 lang=de" {
+		t.Errorf("variants mixed up: en=%q de=%q", gotEn.Body.String(), gotDe.Body.String())
+	}
+
+	if n := rc.Purge(httptest.NewRequest(http.MethodGet, "/x", nil)); n != 3 {
+		t.Errorf("Purge() = %d, want 3 (marker and two variants)", n)
+	}
+	doRequest(h, http.MethodGet, "/x", en)
+	if calls != 3 {
+		t.Errorf("handler calls = %d, want 3 after purge", calls)
+	}
+}
+
+func TestResponseCacheSkips(t *testing.T) {
+	var calls int
+	rc := NewResponseCache(ResponseCacheOptions{MaxBodySize: 4, DefaultTTL: time.Minute})
+	h := rc.Middleware(countingHandler(&calls, nil))
+
+	doRequest(h, http.MethodPost, "/x", nil)
+	doRequest(h, http.MethodPost, "/x", nil)
+	doRequest(h, http.MethodGet, "/big", nil)
+	doRequest(h, http.MethodGet, "/big", nil)
+
+	if calls != 4 {
+		t.Errorf("handler calls = %d, want 4 (POST and oversized bodies are never stored)", calls)
+	}
+}
+
+func TestResponseCacheAPIKeys(t *testing.T) {
+	store, err := NewMemoryKeyStore(
+		APIKey{Hash: HashAPIKey("alice-key"), Principal: "alice"},
+		APIKey{Hash: HashAPIKey("bob-key"), Principal: "bob"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := NewResponseCache(ResponseCacheOptions{DefaultTTL: time.Minute})
+	h := Chain{APIKeyMiddleware(APIKeyOptions{Store: store}), rc.Middleware}.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		fmt.Fprintf(w, "data of %s", p.ID)
+	})
+
+	for _, user := range []string{"alice", "bob"} {
+		rec := doRequest(h, http.MethodGet, "/me", http.Header{"X-Api-Key": {user + "-key"}})
+		if want := "data of " + user; rec.Body.String() != want {
+			t.Errorf("%s got %q, want %q", user, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestResponseCacheOuterHeaders(t *testing.T) {
+	var calls int
+	cfg := &Config{logger: slog.New(slog.DiscardHandler)}
+	rc := NewResponseCache(ResponseCacheOptions{})
+	h := Chain{cfg.LoggingMiddleware, rc.Middleware}.Then(countingHandler(&calls, http.Header{"Cache-Control": {"max-age=60"}}))
+
+	withID := func(id string) http.Header {
+		h := http.Header{}
+		h.Set(RequestIDHeader, id)
+		return h
+	}
+	doRequest(h, http.MethodGet, "/x", withID("first-id"))
+	rec := doRequest(h, http.MethodGet, "/x", withID("second-id"))
+
+	if got := rec.Header().Get("X-Cache"); got != "HIT" {
+		t.Fatalf("X-Cache = %q, want HIT", got)
+	}
+	if got := rec.Header().Get(RequestIDHeader); got != "second-id" {
+		t.Errorf("%s = %q, want the second request's id", RequestIDHeader, got)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "max-age=60" {
+		t.Errorf("Cache-Control = %q, want the stored max-age=60", got)
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter wraps an http.ResponseWriter to record the status code and body size.
+// It implements Unwrap so http.ResponseController reaches the underlying writer, and also
+// Flush, Hijack and ReadFrom directly for code that type-asserts for those interfaces.
+type ResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+// NewResponseWriter wraps w. Wrapping a *ResponseWriter again returns it as is.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// Status returns the status code sent, 200 if the handler wrote a body without calling WriteHeader
+// and 0 if nothing was sent yet.
+func (rw *ResponseWriter) Status() int {
+	return rw.status
+}
+
+// BytesWritten returns the number of body bytes written.
+func (rw *ResponseWriter) BytesWritten() int64 {
+	return rw.bytes
+}
+
+// WroteHeader reports whether the response headers were sent, after which the status can't change.
+func (rw *ResponseWriter) WroteHeader() bool {
+	return rw.wroteHeader
+}
+
+func (rw *ResponseWriter) WriteHeader(code int) {
+	// Informational responses, eg. 103 Early Hints, may precede the final status.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		rw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *ResponseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom lets io.Copy use the underlying writer's ReadFrom, eg. sendfile for *os.File bodies.
+func (rw *ResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	var (
+		n   int64
+		err error
+	)
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{rw.ResponseWriter}, src)
+	}
+	rw.bytes += n
+	return n, err
+}
+
+// Flush sends buffered data to the client, a no-op if the underlying writer can't flush.
+func (rw *ResponseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack lets the handler take over the connection, eg. for websockets.
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// writerOnly hides any ReadFrom method so io.Copy doesn't recurse into ResponseWriter.ReadFrom.
+type writerOnly struct {
+	io.Writer
+}
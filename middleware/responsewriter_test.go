@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(w http.ResponseWriter)
+		status  int
+		bytes   int64
+	}{
+		{"nothing written", func(w http.ResponseWriter) {}, 0, 0},
+		{"implicit 200", func(w http.ResponseWriter) { w.Write([]byte("hello")) }, http.StatusOK, 5},
+		{"explicit status", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNotFound)
+			w.WriteHeader(http.StatusOK) // superfluous, ignored.
+			w.Write([]byte("nope"))
+		}, http.StatusNotFound, 4},
+		{"early hints", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusCreated)
+		}, http.StatusCreated, 0},
+		{"read from", func(w http.ResponseWriter) { io.Copy(w, strings.NewReader("streamed body")) }, http.StatusOK, 13},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := NewResponseWriter(httptest.NewRecorder())
+			tt.handler(rw)
+
+			if rw.Status() != tt.status {
+				t.Errorf("Status() = %d, want %d", rw.Status(), tt.status)
+			}
+			if rw.BytesWritten() != tt.bytes {
+				t.Errorf("BytesWritten() = %d, want %d", rw.BytesWritten(), tt.bytes)
+			}
+		})
+	}
+}
+
+func TestResponseWriterController(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := NewResponseWriter(rec)
+	if NewResponseWriter(rw) != rw {
+		t.Error("wrapping twice should return the same writer")
+	}
+
+	rc := http.NewResponseController(rw)
+	if err := rc.Flush(); err != nil {
+		t.Errorf("Flush() error = %v", err)
+	}
+	if !rec.Flushed {
+		t.Error("Flush did not reach the underlying writer")
+	}
+	if _, _, err := rc.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Hijack() error = %v, want http.ErrNotSupported from the recorder", err)
+	}
+	if rw.Status() != http.StatusOK {
+		t.Errorf("Status() after Flush = %d, want 200", rw.Status())
+	}
+}
+
+func TestLoggingMiddlewareAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &Config{logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+	h := cfg.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/brew", nil))
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry %q: %v", logs.String(), err)
+	}
+	if entry["status"] != float64(http.StatusTeapot) || entry["bytes"] != float64(15) || entry["path"] != "/brew" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+	if _, ok := entry["duration"]; !ok {
+		t.Error("entry has no duration")
+	}
+	if id, _ := entry["request_id"].(string); id == "" {
+		t.Error("entry has no request_id")
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Router registers handlers on an http.ServeMux, wrapped in the middleware of the group they belong to.
+// eg.
+//
+//	r := NewRouter(Chain{cfg.LoggingMiddleware})
+//	r.HandleFunc("GET /health", health)
+//	admin := r.Group("/admin", Chain{AuthMiddleware(opts), RequireRoles("admin")})
+//	admin.HandleFunc("DELETE /users/{id}", deleteUser) // DELETE /admin/users/{id}, logged and authorized.
+//
+// Middleware only runs for requests that match a registered pattern, unmatched requests get the mux's
+// 404 or 405 directly. Wrap the Router itself for middleware that must see every request.
+type Router struct {
+	mux    *http.ServeMux
+	prefix string
+	chain  Chain
+}
+
+// NewRouter creates a Router on a new ServeMux, chain wraps every handler registered on it or its groups.
+func NewRouter(chain Chain) *Router {
+	return &Router{mux: http.NewServeMux(), chain: chain}
+}
+
+// Group returns a Router registering on the same mux under prefix, eg. "/admin", whose handlers
+// are wrapped in rt's middleware followed by chain. Groups nest.
+func (rt *Router) Group(prefix string, chain Chain) *Router {
+	return &Router{
+		mux:    rt.mux,
+		prefix: rt.prefix + strings.TrimSuffix(prefix, "/"),
+		chain:  rt.chain.Extend(chain),
+	}
+}
+
+// Handle registers h for pattern under the group's prefix. Patterns have the ServeMux syntax,
+// [METHOD ][HOST]/[PATH], the method and host are kept and the prefix goes in front of the path.
+func (rt *Router) Handle(pattern string, h http.Handler) {
+	rt.mux.Handle(rt.pattern(pattern), rt.chain.Then(h))
+}
+
+// HandleFunc registers h for pattern under the group's prefix, see Handle.
+func (rt *Router) HandleFunc(pattern string, h http.HandlerFunc) {
+	rt.Handle(pattern, h)
+}
+
+// ServeHTTP dispatches the request to the handler whose pattern matches it.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// pattern prefixes the path of pattern.
+func (rt *Router) pattern(pattern string) string {
+	if rt.prefix == "" {
+		return pattern
+	}
+
+	method, rest := "", pattern
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		method, rest = pattern[:i+1], strings.TrimLeft(pattern[i+1:], " \t")
+	}
+	host, path := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+	// Malformed patterns are left for the mux to reject with its own panic message.
+	return method + host + rt.prefix + path
+}
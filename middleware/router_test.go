@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	echo := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Order", name+" "+r.PathValue("id"))
+		}
+	}
+
+	r := NewRouter(Chain{tag("log")})
+	r.HandleFunc("GET /health", echo("health"))
+	admin := r.Group("/admin/", Chain{tag("auth")})
+	admin.HandleFunc("DELETE /users/{id}", echo("delete"))
+	admin.HandleFunc("GET /{$}", echo("dashboard"))
+	audit := admin.Group("/audit", Chain{tag("audit")})
+	audit.Handle("GET /entries/{id}", echo("entry"))
+	public := r.Group("/public", nil)
+	public.HandleFunc("GET example.com/files/{id}", echo("file"))
+
+	tests := []struct {
+		method, target string
+		status         int
+		want           string
+	}{
+		{http.MethodGet, "/health", http.StatusOK, "log,health "},
+		{http.MethodDelete, "/admin/users/7", http.StatusOK, "log,auth,delete 7"},
+		{http.MethodGet, "/admin/", http.StatusOK, "log,auth,dashboard "},
+		{http.MethodGet, "/admin/audit/entries/3", http.StatusOK, "log,auth,audit,entry 3"},
+		{http.MethodGet, "http://example.com/public/files/9", http.StatusOK, "log,file 9"},
+		{http.MethodGet, "http://other.com/public/files/9", http.StatusNotFound, ""},
+		{http.MethodGet, "/admin/users/7", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/users/7", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := strings.Join(rec.Header().Values("X-Order"), ","); got != tt.want {
+				t.Errorf("order = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
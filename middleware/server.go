@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// RunOptions configures Config.Run.
+type RunOptions struct {
+	// ShutdownTimeout bounds how long in-flight requests get to complete once shutdown starts. Defaults to 30s.
+	ShutdownTimeout time.Duration
+	// Signals start the shutdown. Defaults to SIGINT and SIGTERM.
+	Signals []os.Signal
+	// Listener is served instead of listening on srv.Addr, eg. a listener on port 0 in tests.
+	Listener net.Listener
+}
+
+// Run serves srv until ctx is done or one of opts.Signals arrives, then shuts down gracefully:
+// it stops accepting connections, waits up to opts.ShutdownTimeout for the requests in flight,
+// see Config.Wait, and stops the flight recorder. If requests are still running at the deadline
+// a trace is written first, named trace-shutdown-<unix time>-<random>.out, showing what they were stuck on.
+// Run returns nil after a clean shutdown.
+func (cfg *Config) Run(ctx context.Context, srv *http.Server, opts RunOptions) error {
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 30 * time.Second
+	}
+	if len(opts.Signals) == 0 {
+		opts.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	defer cfg.Close()
+
+	ctx, stop := signal.NotifyContext(ctx, opts.Signals...)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		if opts.Listener != nil {
+			errc <- srv.Serve(opts.Listener)
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+	stop() // a second signal kills the process as usual.
+
+	cfg.logger.Info("shutting down", slog.Duration("timeout", opts.ShutdownTimeout))
+	start := time.Now()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to shut down server: %w", err))
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, fmt.Errorf("server failed: %w", err))
+	}
+	if err := cfg.Wait(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("requests still in flight: %w", err))
+
+		if cfg.fr != nil && cfg.fr.Enabled() {
+			reqID := fmt.Sprintf("shutdown-%d", time.Now().Unix())
+			info := TraceInfo{RequestID: reqID, Reason: "shutdown", Duration: time.Since(start), Timestamp: start}
+			if _, err := cfg.saveTrace(info); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		cfg.logger.Error("shutdown failed", slog.String("error", err.Error()))
+		return err
+	}
+	cfg.logger.Info("shutdown complete", slog.Duration("duration", time.Since(start)))
+	return nil
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime/trace"
+	"testing"
+	"time"
+)
+
+// startRun runs srv through cfg.Run on a local listener, handler requests block until release is closed.
+func startRun(t *testing.T, cfg *Config, ctx context.Context, opts RunOptions) (addr string, started, release chan struct{}, done chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Listener = ln
+
+	started, release = make(chan struct{}, 1), make(chan struct{})
+	srv := &http.Server{Handler: cfg.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))}
+
+	done = make(chan error, 1)
+	go func() { done <- cfg.Run(ctx, srv, opts) }()
+	return ln.Addr().String(), started, release, done
+}
+
+func TestRunDrains(t *testing.T) {
+	cfg, err := New(WithLogger(slog.New(slog.DiscardHandler)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, started, release, done := startRun(t, cfg, ctx, RunOptions{ShutdownTimeout: 5 * time.Second})
+
+	respc := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			resp.Body.Close()
+		}
+		respc <- err
+	}()
+	<-started
+
+	cancel()
+	select {
+	case err := <-done:
+		t.Fatalf("Run() returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-respc; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+}
+
+func TestRunDeadline(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := New(
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithFlightRecorder(trace.FlightRecorderConfig{}),
+		WithTraceOptions(TraceOptions{Dir: dir}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, started, release, done := startRun(t, cfg, ctx, RunOptions{ShutdownTimeout: 50 * time.Millisecond})
+	defer close(release)
+
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	err = <-done
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() = %v, want context.DeadlineExceeded", err)
+	}
+	traces, _ := filepath.Glob(filepath.Join(dir, "trace-shutdown-*.out"))
+	if len(traces) != 1 {
+		t.Errorf("shutdown traces = %v, want one", traces)
+	}
+	if cfg.fr.Enabled() {
+		t.Error("flight recorder still running after Run returned")
+	}
+}
+
+func TestRunListenError(t *testing.T) {
+	cfg, err := New(WithLogger(slog.New(slog.DiscardHandler)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.Run(context.Background(), &http.Server{Addr: "invalid:address:here"}, RunOptions{})
+	if err == nil {
+		t.Error("Run() = nil for an unusable address")
+	}
+}
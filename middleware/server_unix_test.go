@@ -0,0 +1,41 @@
+//go:build unix
+
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunSignal(t *testing.T) {
+	cfg, err := New(WithLogger(slog.New(slog.DiscardHandler)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Catch the signal here too, so one sent before Run installs its handler doesn't kill the test.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	defer signal.Stop(sigs)
+
+	_, _, _, done := startRun(t, cfg, context.Background(), RunOptions{Signals: []os.Signal{syscall.SIGUSR1}})
+
+	timeout := time.After(5 * time.Second)
+	for {
+		syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Run() = %v, want nil", err)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("Run() didn't return after the signal")
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// TimeoutOptions configures Config.Timeout.
+type TimeoutOptions struct {
+	Timeout time.Duration // Deadline of the request context, required.
+	// Status is sent when the handler misses the deadline, http.StatusServiceUnavailable (default)
+	// or http.StatusGatewayTimeout.
+	Status int
+	// OnTimeout responds when the handler misses the deadline. Defaults to a problem+json with Status.
+	OnTimeout http.Handler
+	// Trace writes a flight recorder trace when the handler misses the deadline, see WithFlightRecorder.
+	Trace bool
+}
+
+// Timeout bounds how long the handler may take. The request context gets a deadline, and if the handler
+// hasn't returned when it passes the client gets a timeout response right away. The handler keeps running
+// until it notices the context is done, its late writes fail with http.ErrHandlerTimeout, and it still counts
+// as in flight, see Config.Wait.
+// The response is buffered until the handler returns, so Flush and Hijack aren't available behind Timeout.
+// Panics in the handler are re-raised on the serving goroutine for RecoverMiddleware, along with the
+// handler's stack, panics after the timeout response went out are logged.
+// It panics unless opts.Timeout is positive.
+func (cfg *Config) Timeout(opts TimeoutOptions) func(http.Handler) http.Handler {
+	if opts.Timeout <= 0 {
+		panic(fmt.Sprintf("middleware: Timeout needs a positive timeout, got %s", opts.Timeout))
+	}
+	if opts.Status == 0 {
+		opts.Status = http.StatusServiceUnavailable
+	}
+	if opts.OnTimeout == nil {
+		opts.OnTimeout = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			WriteProblem(w, Problem{
+				Status:   opts.Status,
+				Title:    "Request timed out",
+				Detail:   fmt.Sprintf("The request didn't complete within %s.", opts.Timeout),
+				Instance: r.URL.Path,
+			})
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(r.Context(), opts.Timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan *handlerPanic, 1)
+
+			cfg.wg.Add(1)
+			go func() {
+				defer cfg.wg.Done()
+				defer func() {
+					v := recover()
+					if v == nil {
+						return
+					}
+					// The stack is only the handler's here, the serving goroutine's would point at Timeout.
+					p := &handlerPanic{value: v, stack: debug.Stack()}
+					tw.mu.Lock()
+					timedOut := tw.timedOut
+					if !timedOut {
+						panicked <- p
+					}
+					tw.mu.Unlock()
+					if timedOut {
+						// The response went out already, nothing is left to recover but the log.
+						cfg.logLatePanic(r, p)
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				p.repanic()
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				// The handler worked on a copy, which may also have had headers removed.
+				dst := w.Header()
+				clear(dst)
+				maps.Copy(dst, tw.header)
+				if tw.status != 0 {
+					w.WriteHeader(tw.status)
+				}
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				tw.timedOut = true
+				tw.mu.Unlock()
+
+				// The handler may have panicked just as the deadline passed, before anything was sent.
+				select {
+				case p := <-panicked:
+					p.repanic()
+				default:
+				}
+
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return // the client went away, there's no one to respond to.
+				}
+
+				reqID, _ := RequestIDFromContext(r.Context())
+				cfg.logger.Warn("request timed out",
+					slog.String("request_id", reqID),
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Duration("timeout", opts.Timeout),
+				)
+				opts.OnTimeout.ServeHTTP(w, r)
+
+				if opts.Trace && cfg.fr != nil && cfg.fr.Enabled() {
+					if reqID == "" {
+						reqID = GenerateUUID()
+					}
+					info := TraceInfo{
+						RequestID: reqID,
+						Reason:    "timeout",
+						Method:    r.Method,
+						Path:      r.URL.Path,
+						Pattern:   r.Pattern,
+						Duration:  time.Since(start),
+						Timestamp: start,
+					}
+					if _, err := cfg.saveTrace(info); err != nil {
+						cfg.logger.Error("failed to write trace",
+							slog.String("request_id", reqID),
+							slog.String("error", err.Error()),
+						)
+					}
+				}
+			}
+		})
+	}
+}
+
+// logLatePanic logs a panic of a handler that had already missed its deadline.
+func (cfg *Config) logLatePanic(r *http.Request, p *handlerPanic) {
+	reqID, _ := RequestIDFromContext(r.Context())
+	cfg.logger.Error("panic after timeout",
+		slog.String("request_id", reqID),
+		slog.String("panic", fmt.Sprint(p.value)),
+		slog.String("stack", string(p.stack)),
+	)
+}
+
+// handlerPanic carries a panic from the goroutine Timeout runs the handler on to the serving one,
+// with the stack of the goroutine that panicked, which RecoverMiddleware logs instead of its own.
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+// repanic panics with p, or with its bare value for http.ErrAbortHandler, which net/http checks for by identity.
+func (p *handlerPanic) repanic() {
+	if err, ok := p.value.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+		panic(p.value)
+	}
+	panic(p)
+}
+
+// String shows the handler's stack in net/http's log when there is no RecoverMiddleware.
+func (p *handlerPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+// timeoutWriter buffers the handler's response, so it can be dropped when the deadline passes first.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	// Informational responses can't be buffered in order with the final one, they are dropped.
+	if tw.timedOut || tw.status != 0 || code < 200 {
+		return
+	}
+	tw.status = code
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"runtime/trace"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	lateWrite := make(chan error, 1)
+
+	tests := []struct {
+		name    string
+		opts    TimeoutOptions
+		handler http.HandlerFunc
+		status  int
+		body    string
+		header  map[string]string
+	}{
+		{"in time", TimeoutOptions{Timeout: time.Second}, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Handler", "yes")
+			w.Header().Del("X-Outer")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		}, http.StatusCreated, "created", map[string]string{"X-Handler": "yes", "X-Outer": ""}},
+		{"implicit 200", TimeoutOptions{Timeout: time.Second}, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}, http.StatusOK, "ok", map[string]string{"X-Outer": "kept"}},
+		{"timed out", TimeoutOptions{Timeout: 20 * time.Millisecond}, func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			time.Sleep(10 * time.Millisecond)
+			w.Header().Set("X-Handler", "late")
+			_, err := w.Write([]byte("late"))
+			lateWrite <- err
+		}, http.StatusServiceUnavailable, `"title":"Request timed out"`, map[string]string{"Content-Type": "application/problem+json", "X-Handler": ""}},
+		{"gateway timeout", TimeoutOptions{Timeout: 20 * time.Millisecond, Status: http.StatusGatewayTimeout}, func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}, http.StatusGatewayTimeout, `"status":504`, nil},
+		{"custom response", TimeoutOptions{Timeout: 20 * time.Millisecond, OnTimeout: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "too slow", http.StatusServiceUnavailable)
+		})}, func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}, http.StatusServiceUnavailable, "too slow", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{logger: slog.New(slog.DiscardHandler)}
+			rec := httptest.NewRecorder()
+			rec.Header().Set("X-Outer", "kept")
+			cfg.Timeout(tt.opts)(tt.handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tt.body)
+			}
+			for name, want := range tt.header {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			// The handler goroutine is tracked until it returns.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := cfg.Wait(ctx); err != nil {
+				t.Errorf("handler still running: %v", err)
+			}
+		})
+	}
+
+	if err := <-lateWrite; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("late write error = %v, want http.ErrHandlerTimeout", err)
+	}
+}
+
+func TestTimeoutRequiresTimeout(t *testing.T) {
+	cfg := &Config{logger: slog.New(slog.DiscardHandler)}
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Timeout(%s) didn't panic", timeout)
+				}
+			}()
+			cfg.Timeout(TimeoutOptions{Timeout: timeout})
+		}()
+	}
+}
+
+// panicInHandler is named so its frame can be looked for in the logged stack.
+func panicInHandler(w http.ResponseWriter, r *http.Request) {
+	panic("boom")
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &Config{logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+	h := cfg.RecoverMiddleware(cfg.Timeout(TimeoutOptions{Timeout: time.Second})(http.HandlerFunc(panicInHandler)))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want the recovered 500", rec.Code)
+	}
+
+	var entry struct{ Panic, Stack string }
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log %q: %v", logs.String(), err)
+	}
+	if entry.Panic != "boom" || !strings.Contains(entry.Stack, "middleware.panicInHandler") {
+		t.Errorf("logged panic %q with a stack missing the handler:\n%s", entry.Panic, entry.Stack)
+	}
+}
+
+func TestTimeoutPanicAfterTimeout(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &Config{logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+	responded := make(chan struct{})
+	h := cfg.Timeout(TimeoutOptions{Timeout: 10 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-responded // panicking any earlier would still be re-raised on the serving goroutine.
+		panicInHandler(w, r)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	close(responded)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := cfg.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "panic after timeout") || !strings.Contains(logs.String(), "middleware.panicInHandler") {
+		t.Errorf("late panic not logged with the handler's stack: %s", logs.String())
+	}
+}
+
+func TestTimeoutTrace(t *testing.T) {
+	var logs bytes.Buffer
+	dir := t.TempDir()
+	cfg, err := New(
+		WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))),
+		WithFlightRecorder(trace.FlightRecorderConfig{}),
+		WithTraceOptions(TraceOptions{Dir: dir}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfg.Close()
+
+	h := cfg.LoggingMiddleware(cfg.Timeout(TimeoutOptions{Timeout: 20 * time.Millisecond, Trace: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.Header.Set(RequestIDHeader, "slow-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	infos, err := listTraces(dir)
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("listTraces() = %v, %v, want the timed out request's trace", infos, err)
+	}
+	if info := infos[0]; info.RequestID != "slow-1" || info.Reason != "timeout" || info.Path != "/slow" {
+		t.Errorf("trace info = %+v", info)
+	}
+
+	var entry map[string]any
+	for line := range strings.Lines(logs.String()) {
+		json.Unmarshal([]byte(line), &entry)
+		if entry["msg"] == "request timed out" {
+			if entry["request_id"] != "slow-1" {
+				t.Errorf("timeout logged with request_id %v", entry["request_id"])
+			}
+			return
+		}
+	}
+	t.Errorf("timeout not logged: %s", logs.String())
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TraceOptions configures where and when TraceMiddleware writes flight recorder traces.
+type TraceOptions struct {
+	// Threshold is the duration above which a request is traced. Defaults to 300ms.
+	Threshold time.Duration
+	// RouteThresholds overrides Threshold by ServeMux pattern, eg. "GET /reports/{id}".
+	RouteThresholds map[string]time.Duration
+	// Dir is the directory traces are written to. Defaults to "traces".
+	Dir string
+	// MaxFiles and MaxBytes bound the traces kept in Dir, the oldest are deleted first. Unbounded when zero.
+	MaxFiles int
+	MaxBytes int64
+	// Cooldown is the minimum time between two traces, so a burst of slow requests, which
+	// usually share a cause, writes one trace instead of hundreds. It holds across every route
+	// and middleware of the Config, panic, timeout and shutdown traces included.
+	Cooldown time.Duration
+}
+
+func (o TraceOptions) withDefaults() TraceOptions {
+	if o.Threshold <= 0 {
+		o.Threshold = 300 * time.Millisecond
+	}
+	if o.Dir == "" {
+		o.Dir = "traces"
+	}
+	return o
+}
+
+// threshold returns the threshold for requests matched by pattern.
+func (o TraceOptions) threshold(pattern string) time.Duration {
+	if t, ok := o.RouteThresholds[pattern]; ok {
+		return t
+	}
+	return o.Threshold
+}
+
+// pruneTraces deletes the oldest trace files in dir until at most maxFiles totalling at most
+// maxBytes are left. The newest trace is always kept, even when it alone exceeds maxBytes.
+func pruneTraces(dir string, maxFiles int, maxBytes int64) error {
+	if maxFiles <= 0 && maxBytes <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type traceFile struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []traceFile
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() || !isTraceFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed in the meantime.
+		}
+		files = append(files, traceFile{e.Name(), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	slices.SortFunc(files, func(a, b traceFile) int { return a.modTime.Compare(b.modTime) })
+
+	var errs []error
+	for len(files) > 1 && (maxFiles > 0 && len(files) > maxFiles || maxBytes > 0 && total > maxBytes) {
+		f := files[0]
+		files = files[1:]
+		total -= f.size
+		if err := removeTrace(filepath.Join(dir, f.name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// removeTrace deletes a trace file and its sidecar, either may be missing already.
+func removeTrace(path string) error {
+	var errs []error
+	for _, p := range []string{path, sidecarName(path)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// traceSuffixLen is the length of the random hex suffix newTraceID appends to request ids.
+const traceSuffixLen = 16
+
+// newTraceID returns the id of a new trace of request reqID. Request ids may come from the client,
+// the random suffix keeps a client reusing one from overwriting the trace of another request.
+func newTraceID(reqID string) string {
+	b := make([]byte, traceSuffixLen/2)
+	rand.Read(b)
+	return reqID + "-" + hex.EncodeToString(b)
+}
+
+// splitTraceID returns the request id of a trace id made by newTraceID, ok is false for anything else.
+func splitTraceID(id string) (reqID string, ok bool) {
+	i := len(id) - traceSuffixLen - 1
+	if i < 1 || id[i] != '-' {
+		return "", false
+	}
+	if _, err := hex.DecodeString(id[i+1:]); err != nil {
+		return "", false
+	}
+	reqID = id[:i]
+	return reqID, validRequestID(reqID)
+}
+
+func traceFileName(id string) string {
+	return "trace-" + id + ".out"
+}
+
+// sidecarName returns the path of the JSON file holding the TraceInfo of the trace at path.
+func sidecarName(path string) string {
+	return strings.TrimSuffix(path, ".out") + ".json"
+}
+
+func isTraceFile(name string) bool {
+	return strings.HasPrefix(name, "trace-") && strings.HasSuffix(name, ".out")
+}
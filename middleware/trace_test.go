@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime/trace"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func traceFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestTraceMiddleware(t *testing.T) {
+	fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{})
+	if err := fr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Stop()
+
+	slow := func(w http.ResponseWriter, r *http.Request) { time.Sleep(20 * time.Millisecond) }
+
+	tests := []struct {
+		name string
+		opts TraceOptions
+		reqs []string // paths, request n gets request id "r<n>".
+		want []string
+	}{
+		{"over threshold", TraceOptions{Threshold: 5 * time.Millisecond}, []string{"/slow"}, []string{"trace-r0.json", "trace-r0.out"}},
+		{"under threshold", TraceOptions{Threshold: time.Second}, []string{"/slow"}, nil},
+		{"route threshold", TraceOptions{
+			Threshold:       5 * time.Millisecond,
+			RouteThresholds: map[string]time.Duration{"GET /report": time.Second},
+		}, []string{"/report", "/slow"}, []string{"trace-r1.json", "trace-r1.out"}},
+		{"max files", TraceOptions{Threshold: 5 * time.Millisecond, MaxFiles: 2}, []string{"/slow", "/slow", "/slow"}, []string{"trace-r1.json", "trace-r1.out", "trace-r2.json", "trace-r2.out"}},
+		{"cooldown", TraceOptions{Threshold: 5 * time.Millisecond, Cooldown: time.Hour}, []string{"/slow", "/slow"}, []string{"trace-r0.json", "trace-r0.out"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Dir = filepath.Join(t.TempDir(), "traces")
+			cfg := &Config{fr: fr, logger: slog.New(slog.NewTextHandler(io.Discard, nil)), trace: tt.opts}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /slow", slow)
+			mux.HandleFunc("GET /report", slow)
+			h := cfg.TraceMiddleware(mux)
+
+			for i, path := range tt.reqs {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req = req.WithContext(context.WithValue(req.Context(), requestIDKey, fmt.Sprintf("r%d", i)))
+				h.ServeHTTP(httptest.NewRecorder(), req)
+				time.Sleep(5 * time.Millisecond) // distinct mod times.
+			}
+
+			// Trace ids end in a random suffix, compare by request id.
+			got := traceFiles(t, tt.opts.Dir)
+			for i, name := range got {
+				ext := filepath.Ext(name)
+				if reqID, ok := splitTraceID(strings.TrimSuffix(strings.TrimPrefix(name, "trace-"), ext)); ok {
+					got[i] = "trace-" + reqID + ext
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("traces = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceCooldownAcrossRoutes(t *testing.T) {
+	fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{})
+	if err := fr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Stop()
+
+	dir := t.TempDir()
+	cfg := &Config{fr: fr, logger: slog.New(slog.DiscardHandler), trace: TraceOptions{Dir: dir, Threshold: time.Millisecond, Cooldown: time.Hour}}
+	// The Router wraps each route on its own, the cooldown must still be shared.
+	r := NewRouter(Chain{cfg.TraceMiddleware})
+	slow := func(w http.ResponseWriter, r *http.Request) { time.Sleep(5 * time.Millisecond) }
+	for _, path := range []string{"/a", "/b", "/c"} {
+		r.HandleFunc("GET "+path, slow)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	// Panics are traced too, and count against the same cooldown.
+	cfg.RecoverMiddleware(http.HandlerFunc(panicInHandler)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d", nil))
+
+	if infos, _ := listTraces(dir); len(infos) != 1 {
+		t.Errorf("traces = %+v, want one during the cooldown", infos)
+	}
+}
+
+func TestWriteTraceReusedRequestID(t *testing.T) {
+	fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{})
+	if err := fr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Stop()
+
+	// A client can send the same X-Request-ID twice, the first trace must survive the second.
+	opts := TraceOptions{Dir: t.TempDir()}.withDefaults()
+	for range 2 {
+		if err := writeTrace(fr, opts, TraceInfo{RequestID: "dup", Reason: "slow"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := listTraces(opts.Dir)
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("listTraces() = %v, %v, want two traces", infos, err)
+	}
+	for _, info := range infos {
+		if reqID, ok := splitTraceID(info.ID); !ok || reqID != "dup" || info.RequestID != "dup" {
+			t.Errorf("trace info = %+v", info)
+		}
+	}
+}
+
+func TestPruneTraces(t *testing.T) {
+	now := time.Now()
+	setup := func(t *testing.T) string {
+		dir := t.TempDir()
+		// Named out of order, pruning goes by modification time.
+		ages := map[string]time.Duration{"trace-a.out": 3 * time.Minute, "trace-b.out": 2 * time.Minute, "trace-c.out": time.Minute}
+		for name, age := range ages {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, now, now.Add(-age)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		os.WriteFile(filepath.Join(dir, "trace-a.json"), []byte("{}"), 0644)
+		os.WriteFile(filepath.Join(dir, "notes.txt"), make([]byte, 1000), 0644)
+		return dir
+	}
+
+	tests := []struct {
+		name     string
+		maxFiles int
+		maxBytes int64
+		want     []string
+	}{
+		{"unbounded", 0, 0, []string{"notes.txt", "trace-a.json", "trace-a.out", "trace-b.out", "trace-c.out"}},
+		{"max files", 2, 0, []string{"notes.txt", "trace-b.out", "trace-c.out"}},
+		{"max bytes", 0, 150, []string{"notes.txt", "trace-c.out"}},
+		{"newest kept", 0, 50, []string{"notes.txt", "trace-c.out"}},
+		{"both", 2, 150, []string{"notes.txt", "trace-c.out"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setup(t)
+			if err := pruneTraces(dir, tt.maxFiles, tt.maxBytes); err != nil {
+				t.Fatal(err)
+			}
+			if got := traceFiles(t, dir); !slices.Equal(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TraceInfo describes the request a trace was captured for. It is stored next to each
+// trace-<id>.out as trace-<id>.json.
+type TraceInfo struct {
+	// ID names the trace, the request id plus a random suffix as a request may be traced more than
+	// once and its id may come from the client.
+	ID        string        `json:"id"`
+	RequestID string        `json:"request_id"`
+	Reason    string        `json:"reason,omitempty"` // "slow" or "panic".
+	Method    string        `json:"method,omitempty"`
+	Path      string        `json:"path,omitempty"`
+	Pattern   string        `json:"pattern,omitempty"` // ServeMux pattern that matched the request.
+	Duration  time.Duration `json:"duration"`          // In nanoseconds.
+	Timestamp time.Time     `json:"timestamp"`         // When the request started.
+	Size      int64         `json:"size"`              // Of the trace file, filled in when listing.
+}
+
+// TraceHandler serves the flight recorder traces the middleware of a Config wrote to dir, see
+// TraceOptions.Dir, so a slow or failed request can be looked into without a shell on the host.
+// Traces show what every goroutine was doing, so only requests authorize approves are served,
+// the others get a 403 problem, all of them when authorize is nil.
+// Paths are relative to the handler, eg. http.StripPrefix("/debug/traces", TraceHandler(dir, isAdmin)):
+//
+//	GET    /        the TraceInfo of every trace, newest first
+//	GET    /{id}    the trace with TraceInfo.ID id, for go tool trace
+//	DELETE /{id}    remove the trace with TraceInfo.ID id
+func TraceHandler(dir string, authorize func(*http.Request) bool) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		infos, err := listTraces(dir)
+		if err != nil {
+			WriteProblem(w, Problem{Status: http.StatusInternalServerError, Detail: "failed to list traces", Instance: r.URL.Path})
+			return
+		}
+		body, err := json.Marshal(infos)
+		if err != nil {
+			WriteProblem(w, Problem{Status: http.StatusInternalServerError, Detail: "failed to encode traces", Instance: r.URL.Path})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+
+	mux.HandleFunc("GET /{id}", func(w http.ResponseWriter, r *http.Request) {
+		f, err := openTrace(dir, r.PathValue("id"))
+		if err != nil {
+			WriteProblem(w, Problem{Status: http.StatusNotFound, Detail: "no such trace", Instance: r.URL.Path})
+			return
+		}
+		defer f.Close()
+
+		stat, err := f.Stat()
+		if err != nil {
+			WriteProblem(w, Problem{Status: http.StatusInternalServerError, Detail: "failed to read trace", Instance: r.URL.Path})
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+stat.Name()+`"`)
+		http.ServeContent(w, r, "", stat.ModTime(), f)
+	})
+
+	mux.HandleFunc("DELETE /{id}", func(w http.ResponseWriter, r *http.Request) {
+		f, err := openTrace(dir, r.PathValue("id"))
+		if err != nil {
+			WriteProblem(w, Problem{Status: http.StatusNotFound, Detail: "no such trace", Instance: r.URL.Path})
+			return
+		}
+		f.Close()
+		if err := removeTrace(f.Name()); err != nil {
+			WriteProblem(w, Problem{Status: http.StatusInternalServerError, Detail: "failed to delete trace", Instance: r.URL.Path})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			WriteProblem(w, Problem{Status: http.StatusForbidden, Instance: r.URL.Path})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// openTrace opens the trace file with id in dir. Ids writeTrace wouldn't assign are not found,
+// so the path value can't point outside dir.
+func openTrace(dir, id string) (*os.File, error) {
+	if _, ok := splitTraceID(id); !ok {
+		return nil, fs.ErrNotExist
+	}
+	return os.Open(filepath.Join(dir, traceFileName(id)))
+}
+
+// listTraces returns the traces in dir newest first. Traces without a readable sidecar are
+// listed with what the file itself tells.
+func listTraces(dir string) ([]TraceInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []TraceInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]TraceInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !isTraceFile(e.Name()) {
+			continue
+		}
+		stat, err := e.Info()
+		if err != nil {
+			continue // removed in the meantime.
+		}
+
+		id := strings.TrimSuffix(strings.TrimPrefix(e.Name(), "trace-"), ".out")
+		info := TraceInfo{ID: id, RequestID: id, Timestamp: stat.ModTime()}
+		if reqID, ok := splitTraceID(id); ok {
+			info.RequestID = reqID
+		}
+		if meta, err := os.ReadFile(sidecarName(filepath.Join(dir, e.Name()))); err == nil {
+			json.Unmarshal(meta, &info)
+		}
+		info.Size = stat.Size()
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b TraceInfo) int { return b.Timestamp.Compare(a.Timestamp) })
+	return infos, nil
+}
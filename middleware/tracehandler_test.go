@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTraceHandler(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for _, tr := range []struct {
+		id, data string
+		info     *TraceInfo // nil when the sidecar was lost.
+		age      time.Duration
+	}{
+		{"new-fedcba9876543210", "new trace data", &TraceInfo{ID: "new-fedcba9876543210", RequestID: "new", Reason: "panic", Method: "POST", Path: "/b", Duration: time.Millisecond, Timestamp: now}, 0},
+		{"old-0123456789abcdef", "old trace", &TraceInfo{ID: "old-0123456789abcdef", RequestID: "old", Reason: "slow", Method: "GET", Path: "/a", Duration: time.Second, Timestamp: now.Add(-time.Hour)}, time.Hour},
+		{"bare-00000000000000ff", "x", nil, 2 * time.Hour},
+	} {
+		path := filepath.Join(dir, traceFileName(tr.id))
+		if err := os.WriteFile(path, []byte(tr.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, now, now.Add(-tr.age))
+		if tr.info != nil {
+			meta, _ := json.Marshal(tr.info)
+			os.WriteFile(sidecarName(path), meta, 0644)
+		}
+	}
+
+	const token = "Bearer ops"
+	h := TraceHandler(dir, func(r *http.Request) bool { return r.Header.Get("Authorization") == token })
+	serve := func(h http.Handler, method, target string, authorized bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if authorized {
+			req.Header.Set("Authorization", token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		authorized bool
+		status     int
+		body       string // checked when set.
+	}{
+		{"download", http.MethodGet, "/new-fedcba9876543210", true, http.StatusOK, "new trace data"},
+		{"request id alone", http.MethodGet, "/new", true, http.StatusNotFound, ""},
+		{"unknown trace", http.MethodGet, "/gone-0123456789abcdef", true, http.StatusNotFound, ""},
+		{"outside dir", http.MethodGet, "/..%2Fescape-0123456789abcdef", true, http.StatusNotFound, ""},
+		{"delete unknown", http.MethodDelete, "/gone-0123456789abcdef", true, http.StatusNotFound, ""},
+		{"unsupported method", http.MethodPost, "/", true, http.StatusMethodNotAllowed, ""},
+		{"not authorized", http.MethodGet, "/new-fedcba9876543210", false, http.StatusForbidden, ""},
+		{"delete not authorized", http.MethodDelete, "/old-0123456789abcdef", false, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, tt.authorized)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.body)
+			}
+		})
+	}
+
+	t.Run("nil authorize", func(t *testing.T) {
+		if rec := serve(TraceHandler(dir, nil), http.MethodGet, "/", true); rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", rec.Code)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		var infos []TraceInfo
+		if err := json.Unmarshal(serve(h, http.MethodGet, "/", true).Body.Bytes(), &infos); err != nil {
+			t.Fatalf("invalid listing: %v", err)
+		}
+		want := []TraceInfo{
+			{ID: "new-fedcba9876543210", RequestID: "new", Reason: "panic", Method: "POST", Path: "/b", Duration: time.Millisecond, Size: 14},
+			{ID: "old-0123456789abcdef", RequestID: "old", Reason: "slow", Method: "GET", Path: "/a", Duration: time.Second, Size: 9},
+			{ID: "bare-00000000000000ff", RequestID: "bare", Size: 1}, // what the file name tells.
+		}
+		if len(infos) != len(want) {
+			t.Fatalf("listed %d traces, want %d", len(infos), len(want))
+		}
+		for i := range want {
+			infos[i].Timestamp = time.Time{}
+			if infos[i] != want[i] {
+				t.Errorf("infos[%d] = %+v, want %+v", i, infos[i], want[i])
+			}
+		}
+	})
+
+	t.Run("list without dir", func(t *testing.T) {
+		empty := TraceHandler(filepath.Join(dir, "none"), func(*http.Request) bool { return true })
+		if rec := serve(empty, http.MethodGet, "/", false); rec.Code != http.StatusOK || rec.Body.String() != "[]" {
+			t.Errorf("got %d %q, want 200 []", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if rec := serve(h, http.MethodDelete, "/old-0123456789abcdef", true); rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", rec.Code)
+		}
+		for _, name := range []string{"trace-old-0123456789abcdef.out", "trace-old-0123456789abcdef.json"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+				t.Errorf("%s still exists", name)
+			}
+		}
+		if rec := serve(h, http.MethodDelete, "/old-0123456789abcdef", true); rec.Code != http.StatusNotFound {
+			t.Errorf("second delete status = %d, want 404", rec.Code)
+		}
+	})
+}